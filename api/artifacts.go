@@ -0,0 +1,260 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/store"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	artifactsPath = "artifacts"
+	testCasesPath = "testcases"
+
+	tarGzArchive = "tar.gz"
+	zipArchive   = "zip"
+)
+
+// File saved by test case
+type ArtifactFile struct {
+	Path     string    `json:"path"` // Relative to requested directory
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+/*
+GET    /launches/<launchId>/artifacts[?archive=tar.gz|zip]
+DELETE /launches/<launchId>/artifacts
+GET    /launches/<launchId>/testcases/<testCaseId>/artifacts[?archive=tar.gz|zip]
+GET    /launches/<launchId>/testcases/<testCaseId>/artifacts/<file path>
+*/
+func launchArtifacts(conf *config.Config, history *store.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestId := serial()
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, launchesPath), "/")
+		for _, part := range parts {
+			if !isValidPathElement(part) {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		launchId := parts[0]
+		if owner, _ := launchOwner(history, launchId); !checkOwner(w, r, owner) {
+			return
+		}
+		switch {
+		case len(parts) == 2 && parts[1] == artifactsPath:
+			if r.Method == http.MethodDelete {
+				deleteArtifacts(requestId, conf, launchId, w)
+				return
+			}
+			dir := filepath.Join(conf.DataDir, launchId)
+			serveArtifacts(requestId, w, r, dir, launchId)
+		case len(parts) == 4 && parts[1] == testCasesPath && parts[3] == artifactsPath:
+			dir := filepath.Join(conf.DataDir, launchId, parts[2])
+			serveArtifacts(requestId, w, r, dir, parts[2])
+		case len(parts) > 4 && parts[1] == testCasesPath && parts[3] == artifactsPath:
+			dir := filepath.Join(conf.DataDir, launchId, parts[2])
+			serveArtifact(requestId, w, r, dir, filepath.Join(parts[4:]...))
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func deleteArtifacts(requestId RequestId, conf *config.Config, launchId string, w http.ResponseWriter) {
+	if _, running := launches.Get(launchId); running {
+		writeError(w, http.StatusConflict, fmt.Sprintf("Launch %s is running", launchId))
+		return
+	}
+	if !isLaunchDir(conf, launchId) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No artifacts for launch %s", launchId))
+		return
+	}
+	err := removeArtifacts(requestId, conf, launchId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logging.Request(requestId).Launch(launchId).Err(err).Error("FAILED_TO_REMOVE_ARTIFACTS")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists files in directory or streams them as an archive
+func serveArtifacts(requestId RequestId, w http.ResponseWriter, r *http.Request, dir string, name string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		logging.Request(requestId).With("method", r.Method).Warn("UNSUPPORTED_ARTIFACTS_METHOD")
+		return
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	var err error
+	switch archive := r.URL.Query().Get("archive"); archive {
+	case "":
+		var artifacts []ArtifactFile
+		artifacts, err = listArtifacts(dir)
+		if err == nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(artifacts)
+		}
+	case tarGzArchive:
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.tar.gz\"", name))
+		err = writeTarGz(w, dir)
+	case zipArchive:
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", name))
+		err = writeZip(w, dir)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported archive format: %s, expected %s or %s", archive, tarGzArchive, zipArchive))
+		return
+	}
+	if err != nil {
+		logging.Request(requestId).With("path", dir).Err(err).Error("FAILED_TO_SERVE_ARTIFACTS")
+	}
+}
+
+// Sends a single file supporting range requests
+func serveArtifact(requestId RequestId, w http.ResponseWriter, r *http.Request, dir string, rel string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		logging.Request(requestId).With("method", r.Method).Warn("UNSUPPORTED_ARTIFACTS_METHOD")
+		return
+	}
+	file, ok := artifactFile(dir, rel)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fi.Name()))
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
+
+// Test case directory is writable from container, so like archives single files
+// are only served when neither they nor directories on the way are symlinks
+func artifactFile(dir string, rel string) (string, bool) {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", false
+	}
+	file := filepath.Join(realDir, rel)
+	realFile, err := filepath.EvalSymlinks(file)
+	if err != nil || realFile != file {
+		return "", false
+	}
+	fi, err := os.Lstat(file)
+	if err != nil || !fi.Mode().IsRegular() {
+		return "", false
+	}
+	return file, true
+}
+
+func listArtifacts(dir string) ([]ArtifactFile, error) {
+	artifacts := []ArtifactFile{}
+	err := walkFiles(dir, func(rel string, fi os.FileInfo, _ string) error {
+		artifacts = append(artifacts, ArtifactFile{Path: rel, Size: fi.Size(), Modified: fi.ModTime()})
+		return nil
+	})
+	return artifacts, err
+}
+
+func writeTarGz(w io.Writer, dir string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	err := walkFiles(dir, func(rel string, fi os.FileInfo, file string) error {
+		header, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		return copyFile(tw, file)
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func writeZip(w io.Writer, dir string) error {
+	zw := zip.NewWriter(w)
+	err := walkFiles(dir, func(rel string, fi os.FileInfo, file string) error {
+		header, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		header.Method = zip.Deflate
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		return copyFile(fw, file)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Calls fn for every regular file in directory with its slash separated relative path
+func walkFiles(dir string, fn func(rel string, fi os.FileInfo, file string) error) error {
+	return filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), fi, file)
+	})
+}
+
+func copyFile(w io.Writer, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Protects against escaping data directory with IDs like ".."
+func isValidPathElement(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/aerokube/rt/auth"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/store"
+	"net/http"
+	"strings"
+)
+
+type callerKey struct{}
+
+// Requires bearer token with scope when authentication is enabled
+func authorize(conf *config.Config, scope string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokens, enabled := conf.Tokens()
+		if !enabled {
+			handler(w, r)
+			return
+		}
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="rt"`)
+			writeError(w, http.StatusUnauthorized, "A bearer token is required")
+			logging.Request(serial()).With("path", r.URL.Path).Warn("MISSING_TOKEN")
+			return
+		}
+		token, ok := auth.Find(tokens, strings.TrimPrefix(header, "Bearer "))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="rt", error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, "Invalid token")
+			logging.Request(serial()).With("path", r.URL.Path).Warn("INVALID_TOKEN")
+			return
+		}
+		if !token.Allows(scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="rt", error="insufficient_scope", scope="%s"`, scope))
+			writeError(w, http.StatusForbidden, fmt.Sprintf("Scope %s is required", scope))
+			logging.Request(serial()).With("path", r.URL.Path).With("token", token.Name).With("scope", scope).Warn("INSUFFICIENT_SCOPE")
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, token)))
+	}
+}
+
+// Token request was authorized with, nil when authentication is disabled
+func caller(r *http.Request) *auth.Token {
+	token, _ := r.Context().Value(callerKey{}).(*auth.Token)
+	return token
+}
+
+// Owner of running or finished launch
+func launchOwner(history *store.Store, launchId string) (string, bool) {
+	if launch, ok := launches.Get(launchId); ok {
+		return launch.Owner, true
+	}
+	if record, ok, err := history.GetLaunch(launchId); err == nil && ok {
+		return record.Owner, true
+	}
+	return "", false
+}
+
+// Owner of running or finished test case
+func testCaseOwner(history *store.Store, testCaseId string) (string, bool) {
+	if rtc, ok := testCases.Get(testCaseId); ok {
+		return launchOwner(history, rtc.LaunchId)
+	}
+	if records, err := history.FindTestCases(store.Query{Id: testCaseId}); err == nil && len(records) > 0 {
+		return records[len(records)-1].Owner, true
+	}
+	return "", false
+}
+
+// Responds with 403 when caller is not allowed to access launch
+func checkOwner(w http.ResponseWriter, r *http.Request, owner string) bool {
+	token := caller(r)
+	if token.Owns(owner) {
+		return true
+	}
+	writeError(w, http.StatusForbidden, "Launch was created with another token")
+	logging.Request(serial()).With("path", r.URL.Path).With("token", token.Name).Warn("NOT_AN_OWNER")
+	return false
+}
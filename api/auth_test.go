@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	"github.com/aerokube/rt/auth"
+	"github.com/aerokube/rt/config"
+)
+
+func authorizedRequest(conf *config.Config, scope string, secret string, owner string) *httptest.ResponseRecorder {
+	handler := authorize(conf, scope, func(w http.ResponseWriter, r *http.Request) {
+		if checkOwner(w, r, owner) {
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+	req := httptest.NewRequest(http.MethodGet, "/history/launches/some-launch", nil)
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestAuthorize(t *testing.T) {
+	conf := config.NewConfig(dataDir, 2*time.Hour, 5*time.Minute)
+	AssertThat(t, authorizedRequest(conf, auth.ReadEventsScope, "", "team-a").Code, EqualTo{http.StatusOK})
+
+	AssertThat(t, conf.LoadTokens("../config/test-tokens.yml"), Is{nil})
+	rec := authorizedRequest(conf, auth.ReadEventsScope, "", "team-a")
+	AssertThat(t, rec.Code, EqualTo{http.StatusUnauthorized})
+	AssertThat(t, rec.Header().Get("WWW-Authenticate"), Not{""})
+	AssertThat(t, authorizedRequest(conf, auth.ReadEventsScope, "wrong-secret", "team-a").Code, EqualTo{http.StatusUnauthorized})
+	AssertThat(t, authorizedRequest(conf, auth.AdminScope, "team-a-secret", "team-a").Code, EqualTo{http.StatusForbidden})
+	AssertThat(t, authorizedRequest(conf, auth.ReadEventsScope, "team-a-secret", "team-a").Code, EqualTo{http.StatusOK})
+	AssertThat(t, authorizedRequest(conf, auth.ReadEventsScope, "team-a-secret", "team-b").Code, EqualTo{http.StatusForbidden})
+	AssertThat(t, authorizedRequest(conf, auth.ReadEventsScope, "ops-secret", "team-b").Code, EqualTo{http.StatusOK})
+}
@@ -1,18 +1,24 @@
 package api
 
 import (
+	"fmt"
 	. "github.com/aerokube/rt/common"
 	"github.com/aerokube/rt/config"
 	"github.com/aerokube/rt/event"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/s3"
 	"github.com/aerokube/rt/service"
-	"log"
+	"github.com/aerokube/rt/store"
+	"github.com/aerokube/rt/tracing"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	launches = &Launches{launches: make(map[string] *Launch)}
 	testCases = &TestCases{testCases: make(map[string] *RunningTestCase)}
+	quotas = &Quotas{active: make(map[string]int)}
 )
 
 type Launches struct {
@@ -45,6 +51,38 @@ func (l *Launches) Delete(launchId string) {
 	delete(l.launches, launchId)
 }
 
+// Number of queued and running test cases per launch owner
+type Quotas struct {
+	lock   sync.Mutex
+	active map[string]int
+}
+
+// Acquire reserves n test cases for owner unless it would have more than max of them, zero max means no limit
+func (q *Quotas) Acquire(client string, n int, max int) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if max > 0 && q.active[client]+n > max {
+		return false
+	}
+	q.active[client] += n
+	return true
+}
+
+func (q *Quotas) Release(client string, n int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.active[client] -= n
+	if q.active[client] <= 0 {
+		delete(q.active, client)
+	}
+}
+
+func (q *Quotas) Active(client string) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.active[client]
+}
+
 type TestCases struct {
 	lock      sync.RWMutex
 	testCases map[string]*RunningTestCase // key is testCaseId
@@ -73,6 +111,12 @@ func (t *TestCases) Put(testCaseId string, tc *RunningTestCase) {
 	t.testCases[testCaseId] = tc
 }
 
+func (t *TestCases) Len() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return len(t.testCases)
+}
+
 func (t *TestCases) Delete(testCaseId string) {
 	t.lock.Lock()
 	defer t.lock.Unlock()
@@ -80,128 +124,227 @@ func (t *TestCases) Delete(testCaseId string) {
 }
 
 type RunningTestCase struct {
+	LaunchId   string
 	Cancel     func()
 	Finished   <-chan bool
 	Terminated chan struct{}
+	terminate  sync.Once
+	stopping   int32
 }
 
-func ConsumeLaunches(config *config.Config, exit chan bool) {
-	docker, err := service.NewDocker(config)
-	if err != nil {
-		log.Fatal(err)
-	}
+// Terminate stops and removes container and then revokes test case, it is safe to call more than once
+func (rtc *RunningTestCase) Terminate() {
+	rtc.terminate.Do(func() {
+		atomic.StoreInt32(&rtc.stopping, 1)
+		rtc.Cancel()
+		close(rtc.Terminated)
+	})
+}
+
+// Container exits when it is stopped so finished test case can actually be a terminated one
+func (rtc *RunningTestCase) isStopping() bool {
+	return atomic.LoadInt32(&rtc.stopping) == 1
+}
+
+func ConsumeLaunches(config *config.Config, docker *service.Docker, history *store.Store, uploader *s3.Client, exit chan bool) {
+	recoverTestCases(config, docker, history, uploader)
+	go collectGarbage(config, docker, exit)
+	go cleanDataDir(config, history, exit)
 	for {
 		select {
 		case <-exit:
-			waitForTestCasesToFinish(config)
 			return
 		case launchRequest := <-launchesQueue:
 			{
 				requestId := launchRequest.RequestId
 				launchId := launchRequest.Id
+				// Launch was counted as active by request handler
 				if launch, ok := launches.Get(launchId); ok {
-					go launchImpl(requestId, config, docker, launch)
+					go func() {
+						defer activeLaunches.Done()
+						launchImpl(requestId, config, docker, history, uploader, launch, launchRequest.Span)
+					}()
 				} else {
-					log.Printf("[%d] [MISSING_LAUNCH] [%s]\n", requestId, launchId)
+					activeLaunches.Done()
+					logging.Request(requestId).Launch(launchId).Warn("MISSING_LAUNCH")
 				}
 			}
 		}
 	}
 }
 
-func waitForTestCasesToFinish(config *config.Config) {
-	log.Printf("[SHUTTING_DOWN] [%s] [%d]\n", config.ShutdownTimeout, len(testCases.testCases))
-	testCases.ForEach(func(tc *RunningTestCase) {
-		go func() {
-			select {
-			case <-tc.Terminated:
-				return
-			case <-time.After(config.ShutdownTimeout):
-				close(tc.Terminated)
-			}
-		}()
-	})
-}
-
-func launchImpl(requestId RequestId, config *config.Config, docker *service.Docker, launch *Launch) {
-	containerType := launch.Type
+func launchImpl(requestId RequestId, config *config.Config, docker *service.Docker, history *store.Store, uploader *s3.Client, launch *Launch, parent *tracing.Span) {
 	launchId := launch.Id
+	span := tracing.Start("launch", parent).SetAttribute("launch.id", launchId).SetAttribute("launch.type", launch.Type)
+	defer span.End()
+	webhooks.Register(launchId, launch.Webhooks)
+	defer webhooks.Unregister(launchId)
 	eventBus.Fire(event.LaunchStarted, launchId)
-	log.Printf("[%d] [LAUNCH_STARTED] [%s] [%s]\n", requestId, launchId, containerType)
-	if container, ok := config.GetContainer(containerType); ok {
-		parallelBuilds := GetParallelBuilds(container, launch)
+	logging.Request(requestId).Launch(launchId).With("type", launch.Type).With("properties", MaskProperties(launch.Properties)).Info("LAUNCH_STARTED")
+	properties, err := resolveSecrets(config, launch.Properties)
+	if err != nil {
+		quotas.Release(launch.Client, len(launch.TestCases))
+		launches.Delete(launchId)
+		span.SetError(err)
+		now := time.Now()
+		saveLaunch(requestId, history, &store.LaunchRecord{
+			Id:         launchId,
+			Type:       launch.Type,
+			TestCases:  testCaseIds(launch),
+			Properties: MaskProperties(launch.Properties),
+			Started:    now,
+			Finished:   now,
+			Owner:      launch.Owner,
+		})
+		eventBus.Fire(event.LaunchFinished, launchId)
+		logging.Request(requestId).Launch(launchId).Err(err).Error("FAILED_TO_RESOLVE_SECRETS")
+		return
+	}
+	if container, containerType, ok := config.FindContainer(launch.Type, launch.Container); ok {
+		resolved := *launch
+		resolved.Properties = properties
+		parallelBuilds := GetParallelBuilds(container, &resolved)
+		quotas.Release(launch.Client, len(launch.TestCases)-len(parallelBuilds))
+		launchRecord := &store.LaunchRecord{
+			Id:         launchId,
+			Type:       launch.Type,
+			Container:  containerType,
+			Properties: MaskProperties(launch.Properties),
+			TestCases:  testCaseIds(launch),
+			Started:    time.Now(),
+			Owner:      launch.Owner,
+		}
+		saveLaunch(requestId, history, launchRecord)
+		launchesTotal.Inc(containerType)
+		span.SetAttribute("container.type", containerType).SetAttribute("test_cases", len(parallelBuilds))
 		wg := sync.WaitGroup{}
 		wg.Add(len(parallelBuilds))
 		for testCaseId, bs := range parallelBuilds {
 			bs.RequestId = requestId
+			bs.ContainerType = containerType
 			go func(testCaseId string, bs service.BuildSettings) {
+				defer quotas.Release(launch.Client, 1)
+				entry := logging.Request(requestId).Launch(launchId).ContainerType(containerType).TestCase(testCaseId)
 				_, testCaseIsAlreadyRunning := testCases.Get(testCaseId)
 				if testCaseIsAlreadyRunning {
-					log.Printf("[%d] [TEST_CASE_ALREADY_RUNNING] [%s] [%s] [%s]\n", requestId, launchId, containerType, testCaseId)
+					entry.Warn("TEST_CASE_ALREADY_RUNNING")
 					wg.Done()
 					return
 				}
 				start := time.Now()
-				log.Printf("[%d] [LAUNCHING] [%s] [%s] [%s]\n", requestId, launchId, containerType, testCaseId)
+				testCaseRecord := &store.TestCaseRecord{
+					Id:           testCaseId,
+					LaunchId:     launchId,
+					Name:         bs.BuildData.TestCase.Name,
+					Tags:         bs.BuildData.TestCase.Tags,
+					Outcome:      store.Running,
+					Started:      start,
+					ArtifactPath: docker.HostDataDir(&bs),
+					Owner:        launch.Owner,
+				}
+				addTestCase(requestId, history, testCaseRecord)
+				entry.Info("LAUNCHING")
+				bs.Span = tracing.Start("test_case", span).SetAttribute("test_case.id", testCaseId).SetAttribute("test_case.name", bs.BuildData.TestCase.Name)
+				testCasesQueued.Inc()
 				cancel, finished, err := docker.StartWithCancel(&bs)
+				testCasesQueued.Dec()
 				if err != nil {
-					eventBus.Fire(event.TestCaseNotStarted, testCaseId)
-					log.Printf("[%d] [FAILED_TO_LAUNCH] [%s] [%s] [%s] %v\n", requestId, launchId, containerType, testCaseId, err)
+					eventBus.FireTestCase(event.TestCaseNotStarted, launchId, testCaseId)
+					finishTestCase(requestId, history, testCaseRecord, store.NotStarted)
+					observeTestCase(containerType, testCaseRecord)
+					bs.Span.SetError(err).End()
+					entry.Err(err).Error("FAILED_TO_LAUNCH")
 					wg.Done()
 					return
 				}
 				rtc := &RunningTestCase{
+					LaunchId:   launchId,
 					Cancel:     cancel,
 					Finished:   finished,
 					Terminated: make(chan struct{}),
 				}
 				testCases.Put(testCaseId, rtc)
-				duration := float64(time.Now().Sub(start).Seconds())
-				eventBus.Fire(event.TestCaseStarted, testCaseId)
-				log.Printf("[%d] [LAUNCHED] [%s] [%s] [%s] [%.2fs]\n", requestId, launchId, containerType, testCaseId, duration)
-				select {
-				case success := <-rtc.Finished:
-					{
-						if success {
-							eventBus.Fire(event.TestCasePassed, testCaseId)
-							log.Printf("[%d] [PASSED] [%s] [%s] [%s]\n", requestId, launchId, containerType, testCaseId)
-						} else {
-							eventBus.Fire(event.TestCaseFailed, testCaseId)
-							log.Printf("[%d] [FAILED] [%s] [%s] [%s]\n", requestId, launchId, containerType, testCaseId)
-						}
-						cancel()
-					}
-
-				case <-rtc.Terminated:
-					{
-						eventBus.Fire(event.TestCaseRevoked, testCaseId)
-						log.Printf("[%d] [TERMINATED] [%s] [%s] [%s]\n", requestId, launchId, containerType, testCaseId)
-					}
-				case <-time.After(config.Timeout):
-					{
-						log.Printf("[%d] [TIMED_OUT] [%s] [%s] [%s]\n", requestId, launchId, containerType, testCaseId)
-						terminateImpl(requestId, testCaseId)
-						eventBus.Fire(event.TestCaseTimedOut, testCaseId)
-						log.Printf("[%d] [TERMINATED] [%s] [%s] [%s]\n", requestId, launchId, containerType, testCaseId)
-					}
-				}
+				eventBus.FireTestCase(event.TestCaseStarted, launchId, testCaseId)
+				entry.Duration(time.Since(start)).Info("LAUNCHED")
+				awaitTestCase(requestId, history, containerType, rtc, testCaseRecord, config.Timeout)
+				uploadArtifacts(requestId, uploader, history, testCaseRecord)
+				bs.Span.SetAttribute("outcome", testCaseRecord.Outcome).End()
 				testCases.Delete(testCaseId)
 				wg.Done()
 			}(testCaseId, bs)
 		}
 		wg.Wait()
 		launches.Delete(launchId)
+		launchRecord.Finished = time.Now()
+		saveLaunch(requestId, history, launchRecord)
 		eventBus.Fire(event.LaunchFinished, launchId)
-		log.Printf("[%d] [LAUNCH_FINISHED] [%s] [%s]\n", requestId, launchId, containerType)
+		logging.Request(requestId).Launch(launchId).ContainerType(containerType).Info("LAUNCH_FINISHED")
 	} else {
-		log.Printf("[%d] [UNSUPPORTED_CONTAINER_TYPE] [%s] [%s]\n", requestId, launchId, containerType)
+		quotas.Release(launch.Client, len(launch.TestCases))
+		launches.Delete(launchId)
+		span.SetError(fmt.Errorf("unsupported container: %s", launch.Container))
+		logging.Request(requestId).Launch(launchId).With("type", launch.Type).ContainerType(launch.Container).Warn("UNSUPPORTED_CONTAINER_TYPE")
+	}
+}
+
+func testCaseIds(launch *Launch) []string {
+	var ret []string
+	for _, testCase := range launch.TestCases {
+		ret = append(ret, testCase.Id)
 	}
+	return ret
 }
 
-func ConsumeTerminates(exit chan bool) {
+// Waits for running test case to finish, to be terminated or to time out
+func awaitTestCase(requestId RequestId, history *store.Store, containerType string, rtc *RunningTestCase, record *store.TestCaseRecord, timeout time.Duration) {
+	launchId := record.LaunchId
+	testCaseId := record.Id
+	entry := logging.Request(requestId).Launch(launchId).ContainerType(containerType).TestCase(testCaseId)
+	select {
+	case success := <-rtc.Finished:
+		{
+			if rtc.isStopping() {
+				<-rtc.Terminated
+				revokeTestCase(requestId, history, record, entry)
+				break
+			}
+			if success {
+				eventBus.FireTestCase(event.TestCasePassed, launchId, testCaseId)
+				finishTestCase(requestId, history, record, store.Passed)
+				entry.Info("PASSED")
+			} else {
+				eventBus.FireTestCase(event.TestCaseFailed, launchId, testCaseId)
+				finishTestCase(requestId, history, record, store.Failed)
+				entry.Info("FAILED")
+			}
+			rtc.Cancel()
+		}
+
+	case <-rtc.Terminated:
+		revokeTestCase(requestId, history, record, entry)
+	case <-time.After(timeout):
+		{
+			entry.Warn("TIMED_OUT")
+			terminateImpl(requestId, testCaseId)
+			eventBus.FireTestCase(event.TestCaseTimedOut, launchId, testCaseId)
+			finishTestCase(requestId, history, record, store.TimedOut)
+			entry.Info("TERMINATED")
+		}
+	}
+	observeTestCase(containerType, record)
+}
+
+func revokeTestCase(requestId RequestId, history *store.Store, record *store.TestCaseRecord, entry *logging.Entry) {
+	eventBus.FireTestCase(event.TestCaseRevoked, record.LaunchId, record.Id)
+	finishTestCase(requestId, history, record, store.Revoked)
+	entry.Info("TERMINATED")
+}
+
+// ConsumeTerminates handles terminate requests until running launches are drained
+func ConsumeTerminates(drained chan bool) {
 	for {
 		select {
-		case <-exit:
+		case <-drained:
 			return
 		case terminateRequest := <-terminateQueue:
 			{
@@ -215,8 +358,7 @@ func ConsumeTerminates(exit chan bool) {
 
 func terminateImpl(requestId RequestId, testCaseId string) {
 	if runningTestCase, ok := testCases.Get(testCaseId); ok {
-		log.Printf("[%d] [TERMINATING] [%s]\n", requestId, testCaseId)
-		runningTestCase.Cancel()
-		close(runningTestCase.Terminated)
+		logging.Request(requestId).TestCase(testCaseId).Info("TERMINATING")
+		runningTestCase.Terminate()
 	}
 }
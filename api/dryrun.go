@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/service"
+	"sort"
+)
+
+// What would be started for a launch, returned instead of starting containers
+type DryRun struct {
+	Id        string                            `json:"id"`
+	Type      string                            `json:"type"`
+	Container string                            `json:"container"`
+	TestCases map[string]*service.ContainerSpec `json:"testcases"`
+}
+
+// Resolves container settings and renders build files of every test case without starting containers
+func dryRun(conf *config.Config, docker *service.Docker, launch *Launch) (*DryRun, error) {
+	container, containerType, ok := conf.FindContainer(launch.Type, launch.Container)
+	if !ok {
+		return nil, fmt.Errorf("unsupported container: %s", launch.Container)
+	}
+	properties, err := resolveSecrets(conf, launch.Properties)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *launch
+	resolved.Properties = properties
+	var paths []string
+	for path := range container.Templates {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	sources, templatesErr := docker.ReadTemplates(container.Image, paths)
+	ret := &DryRun{Id: launch.Id, Type: launch.Type, Container: containerType, TestCases: make(map[string]*service.ContainerSpec)}
+	for testCaseId, bs := range GetParallelBuilds(container, &resolved) {
+		bs.ContainerType = containerType
+		spec := docker.Spec(&bs)
+		if templatesErr != nil {
+			spec.Errors = append(spec.Errors, templatesErr.Error())
+		} else if rendered, err := service.RenderTemplates(bs.Templates, sources, bs.BuildData); err != nil {
+			spec.Errors = append(spec.Errors, err.Error())
+		} else {
+			spec.Templates = rendered
+		}
+		ret.TestCases[testCaseId] = spec
+	}
+	return ret, nil
+}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+)
+
+func TestDryRunUnsupportedContainer(t *testing.T) {
+	conf := config.NewConfig(dataDir, 2*time.Hour, 5*time.Minute)
+	AssertThat(t, conf.Load("../config/test-config.json", "../config/test-log-config.json"), Is{nil})
+	_, err := dryRun(conf, nil, &Launch{Id: "dry-run-launch", Type: "maven", Container: "missing"})
+	AssertThat(t, err, Is{Not{nil}})
+}
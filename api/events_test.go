@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	"github.com/aerokube/rt/event"
+	"github.com/gorilla/websocket"
+)
+
+func TestEventsDelivered(t *testing.T) {
+	c, _, err := websocket.DefaultDialer.Dial(strings.Replace(apiUrl("/events"), "http", "ws", 1), nil)
+	AssertThat(t, err, Is{nil})
+	defer c.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				eventBus.Fire(event.ConfigReloaded, "")
+			}
+		}
+	}()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var evt event.Event
+	AssertThat(t, c.ReadJSON(&evt), Is{nil})
+	AssertThat(t, evt.Type, EqualTo{event.ConfigReloaded})
+}
+
+func TestEventsStopWhenClientCloses(t *testing.T) {
+	finished := make(chan struct{})
+	handler := events(history, make(chan bool))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(finished)
+		handler(w, r)
+	}))
+	defer s.Close()
+	c, _, err := websocket.DefaultDialer.Dial(strings.Replace(s.URL, "http", "ws", 1), nil)
+	AssertThat(t, err, Is{nil})
+	c.Close()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("events handler is still running after client closed connection")
+	}
+}
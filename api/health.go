@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aerokube/rt/auth"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/service"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Time Docker API calls of readiness check can take
+const healthTimeout = 5 * time.Second
+
+// Result of one readiness check
+type HealthCheck struct {
+	Name  string `json:"name"`
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type health struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks,omitempty"`
+}
+
+// Process is up, used as liveness probe
+func live(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health{Status: "ok"})
+}
+
+// Instance can run test cases, used as readiness probe
+func ready(conf *config.Config, docker *service.Docker, exit chan bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+		defer cancel()
+		checks := []HealthCheck{
+			newHealthCheck("shutdown", checkNotShuttingDown(exit)),
+			newHealthCheck("docker", docker.Ping(ctx)),
+			newHealthCheck("images", checkImages(ctx, conf, docker)),
+			newHealthCheck("data_dir", checkWritable(conf.DataDir)),
+			newHealthCheck("disk", checkFreeDisk(conf.DataDir, conf.MinFreeDisk)),
+		}
+		status, code := "ready", http.StatusOK
+		for _, c := range checks {
+			if !c.Ok {
+				status, code = "not ready", http.StatusServiceUnavailable
+				logging.With("check", c.Name).With("message", c.Error).Warn("NOT_READY")
+			}
+		}
+		if !healthDetailsAllowed(conf, r) {
+			for i := range checks {
+				checks[i].Error = ""
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(health{Status: status, Checks: checks})
+	}
+}
+
+// Readiness probe is open, so failure details with image names and errors
+// are only shown to callers allowed to read events
+func healthDetailsAllowed(conf *config.Config, r *http.Request) bool {
+	if conf.ClientCerts && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		return false
+	}
+	tokens, enabled := conf.Tokens()
+	if !enabled {
+		return true
+	}
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token, ok := auth.Find(tokens, strings.TrimPrefix(header, "Bearer "))
+	return ok && token.Allows(auth.ReadEventsScope)
+}
+
+func newHealthCheck(name string, err error) HealthCheck {
+	if err != nil {
+		return HealthCheck{Name: name, Error: err.Error()}
+	}
+	return HealthCheck{Name: name, Ok: true}
+}
+
+func checkNotShuttingDown(exit chan bool) error {
+	select {
+	case <-exit:
+		return fmt.Errorf("shutting down")
+	default:
+		return nil
+	}
+}
+
+func checkImages(ctx context.Context, conf *config.Config, docker *service.Docker) error {
+	var missing []string
+	for _, image := range conf.Images() {
+		if err := docker.InspectImage(ctx, image); err != nil {
+			missing = append(missing, image)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("images are not available: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".health")
+	if err != nil {
+		return fmt.Errorf("data directory is not writable: %v", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
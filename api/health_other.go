@@ -0,0 +1,9 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package api
+
+// Free disk space is not checked on platforms without statfs
+func checkFreeDisk(dir string, min int64) error {
+	return nil
+}
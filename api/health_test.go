@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/service"
+)
+
+func TestCheckWritable(t *testing.T) {
+	AssertThat(t, checkWritable(dataDir), Is{nil})
+	AssertThat(t, checkWritable(path.Join(dataDir, "missing")), Is{Not{nil}})
+}
+
+func TestCheckNotShuttingDown(t *testing.T) {
+	exit := make(chan bool)
+	AssertThat(t, checkNotShuttingDown(exit), Is{nil})
+	close(exit)
+	AssertThat(t, checkNotShuttingDown(exit), Is{Not{nil}})
+}
+
+func readyChecks(conf *config.Config, secret string) map[string]HealthCheck {
+	docker, _ := service.NewDocker(conf)
+	req := httptest.NewRequest(http.MethodGet, readyPath, nil)
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	rec := httptest.NewRecorder()
+	ready(conf, docker, make(chan bool))(rec, req)
+	var body health
+	json.NewDecoder(rec.Body).Decode(&body)
+	checks := make(map[string]HealthCheck)
+	for _, c := range body.Checks {
+		checks[c.Name] = c
+	}
+	return checks
+}
+
+func TestReadyHidesDetails(t *testing.T) {
+	conf := config.NewConfig(path.Join(dataDir, "missing"), 2*time.Hour, 5*time.Minute)
+	AssertThat(t, readyChecks(conf, "")["data_dir"].Error, Not{""})
+
+	AssertThat(t, conf.LoadTokens("../config/test-tokens.yml"), Is{nil})
+	check := readyChecks(conf, "")["data_dir"]
+	AssertThat(t, check.Ok, Is{false})
+	AssertThat(t, check.Error, EqualTo{""})
+	AssertThat(t, readyChecks(conf, "wrong-secret")["data_dir"].Error, EqualTo{""})
+	AssertThat(t, readyChecks(conf, "team-a-secret")["data_dir"].Error, Not{""})
+
+	conf.ClientCerts = true
+	AssertThat(t, readyChecks(conf, "team-a-secret")["data_dir"].Error, EqualTo{""})
+}
@@ -0,0 +1,25 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package api
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func checkFreeDisk(dir string, min int64) error {
+	if min <= 0 {
+		return nil
+	}
+	var st syscall.Statfs_t
+	err := syscall.Statfs(dir, &st)
+	if err != nil {
+		return fmt.Errorf("failed to get free disk space: %v", err)
+	}
+	free := uint64(st.Bavail) * uint64(st.Bsize)
+	if free < uint64(min) {
+		return fmt.Errorf("%d bytes free in data directory, at least %d required", free, min)
+	}
+	return nil
+}
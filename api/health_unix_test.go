@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package api
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/aandryashin/matchers"
+)
+
+func TestCheckFreeDisk(t *testing.T) {
+	AssertThat(t, checkFreeDisk(dataDir, 0), Is{nil})
+	AssertThat(t, checkFreeDisk(dataDir, 1), Is{nil})
+	AssertThat(t, checkFreeDisk(dataDir, 1<<62), Is{Not{nil}})
+	AssertThat(t, checkFreeDisk(path.Join(os.TempDir(), "rt-missing-dir"), 1), Is{Not{nil}})
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aerokube/rt/auth"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/store"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func saveLaunch(requestId RequestId, history *store.Store, launch *store.LaunchRecord) {
+	err := history.PutLaunch(launch)
+	if err != nil {
+		logging.Request(requestId).Launch(launch.Id).Err(err).Error("FAILED_TO_SAVE_HISTORY")
+	}
+}
+
+func addTestCase(requestId RequestId, history *store.Store, tc *store.TestCaseRecord) {
+	err := history.AddTestCase(tc)
+	if err != nil {
+		logging.Request(requestId).Launch(tc.LaunchId).TestCase(tc.Id).Err(err).Error("FAILED_TO_SAVE_HISTORY")
+	}
+}
+
+func finishTestCase(requestId RequestId, history *store.Store, tc *store.TestCaseRecord, outcome string) {
+	tc.Outcome = outcome
+	tc.Finished = time.Now()
+	tc.Duration = tc.Finished.Sub(tc.Started).Seconds()
+	err := history.UpdateTestCase(tc)
+	if err != nil {
+		logging.Request(requestId).Launch(tc.LaunchId).TestCase(tc.Id).Err(err).Error("FAILED_TO_SAVE_HISTORY")
+	}
+}
+
+// GET /history/launches/<launchId>
+func historyLaunch(history *store.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestId := serial()
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			logging.Request(requestId).With("method", r.Method).Warn("UNSUPPORTED_HISTORY_METHOD")
+			return
+		}
+		launchId := strings.TrimPrefix(r.URL.Path, historyLaunchesPath)
+		launch, ok, err := history.GetLaunch(launchId)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.Request(requestId).Launch(launchId).Err(err).Error("HISTORY_ERROR")
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Unknown launch: %s", launchId))
+			return
+		}
+		if !checkOwner(w, r, launch.Owner) {
+			return
+		}
+		tcs, err := history.FindTestCases(store.Query{LaunchId: launchId})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.Request(requestId).Launch(launchId).Err(err).Error("HISTORY_ERROR")
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			*store.LaunchRecord
+			Results []store.TestCaseRecord `json:"results"`
+		}{launch, tcs})
+	}
+}
+
+// GET /history/testcases?launch=<id>&name=<name>&tag=<tag>&outcome=<outcome>&from=<RFC3339>&to=<RFC3339>&limit=<n>
+func historyTestCases(history *store.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestId := serial()
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			logging.Request(requestId).With("method", r.Method).Warn("UNSUPPORTED_HISTORY_METHOD")
+			return
+		}
+		q, err := parseHistoryQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			logging.Request(requestId).Err(err).Warn("INVALID_HISTORY_QUERY")
+			return
+		}
+		if token := caller(r); !token.Allows(auth.AdminScope) {
+			q.Owner = token.Name
+		}
+		tcs, err := history.FindTestCases(q)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.Request(requestId).Err(err).Error("HISTORY_ERROR")
+			return
+		}
+		json.NewEncoder(w).Encode(tcs)
+	}
+}
+
+func parseHistoryQuery(r *http.Request) (store.Query, error) {
+	params := r.URL.Query()
+	q := store.Query{
+		LaunchId: params.Get("launch"),
+		Name:     params.Get("name"),
+		Tag:      params.Get("tag"),
+		Outcome:  params.Get("outcome"),
+	}
+	var err error
+	if from := params.Get("from"); from != "" {
+		if q.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return q, fmt.Errorf("invalid from date: %v", err)
+		}
+	}
+	if to := params.Get("to"); to != "" {
+		if q.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return q, fmt.Errorf("invalid to date: %v", err)
+		}
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit < 0 {
+			return q, fmt.Errorf("invalid limit: %s", limit)
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/service"
+	"sync"
+	"time"
+)
+
+var janitor = &Janitor{}
+
+// What garbage collector has cleaned since start
+type JanitorStats struct {
+	Runs     uint64 `json:"runs"`
+	Orphaned uint64 `json:"orphaned"` // Containers without running test case
+	TimedOut uint64 `json:"timedOut"` // Containers running longer than timeout
+	Failed   uint64 `json:"failed"`   // Containers that could not be removed
+}
+
+type Janitor struct {
+	lock  sync.RWMutex
+	stats JanitorStats
+}
+
+func (j *Janitor) add(orphaned, timedOut, failed uint64) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.stats.Runs++
+	j.stats.Orphaned += orphaned
+	j.stats.TimedOut += timedOut
+	j.stats.Failed += failed
+}
+
+func (j *Janitor) Stats() JanitorStats {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return j.stats
+}
+
+// Periodically removes containers left behind by this rt instance
+func collectGarbage(config *config.Config, docker *service.Docker, exit chan bool) {
+	if config.GCInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(config.GCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exit:
+			return
+		case <-ticker.C:
+			cleanContainers(serial(), config, docker)
+		}
+	}
+}
+
+func cleanContainers(requestId RequestId, config *config.Config, docker *service.Docker) {
+	containers, err := docker.ListContainers()
+	if err != nil {
+		logging.Request(requestId).Err(err).Error("GC_FAILED")
+		return
+	}
+	var orphaned, timedOut, failed uint64
+	now := time.Now()
+	for _, mc := range containers {
+		_, tracked := testCases.Get(mc.TestCaseId)
+		reason := garbageReason(mc, tracked, now, config.Timeout, config.GCGrace)
+		if reason == "" {
+			continue
+		}
+		logging.Request(requestId).Launch(mc.LaunchId).TestCase(mc.TestCaseId).Container(mc.Id).With("reason", reason).Info("GC_REMOVING_CONTAINER")
+		if err := docker.Remove(mc); err != nil {
+			failed++
+			continue
+		}
+		if reason == orphanedContainer {
+			orphaned++
+		} else {
+			timedOut++
+		}
+	}
+	janitor.add(orphaned, timedOut, failed)
+	if orphaned+timedOut+failed > 0 {
+		logging.Request(requestId).With("orphaned", orphaned).With("timed_out", timedOut).With("failed", failed).Info("GC_FINISHED")
+	}
+}
+
+const (
+	orphanedContainer = "ORPHANED"
+	timedOutContainer = "TIMED_OUT"
+)
+
+// Returns why container should be removed or empty string if it should be kept.
+// Grace period protects containers being started right now and test cases being stopped.
+func garbageReason(mc service.ManagedContainer, tracked bool, now time.Time, timeout time.Duration, grace time.Duration) string {
+	age := now.Sub(mc.Created)
+	if age <= grace {
+		return ""
+	}
+	if !tracked {
+		return orphanedContainer
+	}
+	if age > timeout+grace {
+		return timedOutContainer
+	}
+	return ""
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	"github.com/aerokube/rt/service"
+)
+
+func TestGarbageReason(t *testing.T) {
+	now := time.Now()
+	timeout := time.Hour
+	grace := time.Minute
+	created := func(ago time.Duration) service.ManagedContainer {
+		return service.ManagedContainer{Id: "container-id", Created: now.Add(-ago)}
+	}
+	AssertThat(t, garbageReason(created(30*time.Second), false, now, timeout, grace), EqualTo{""})
+	AssertThat(t, garbageReason(created(2*time.Minute), false, now, timeout, grace), EqualTo{orphanedContainer})
+	AssertThat(t, garbageReason(created(30*time.Minute), true, now, timeout, grace), EqualTo{""})
+	AssertThat(t, garbageReason(created(2*time.Hour), true, now, timeout, grace), EqualTo{timedOutContainer})
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/service"
+	"github.com/aerokube/rt/store"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const logsPath = "logs"
+
+// GET /testcases/<testCaseId>/logs?follow=true&tail=100 streams container output as server-sent events
+func testCaseLogs(docker *service.Docker, history *store.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestId := serial()
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, testCasesRootPath), "/")
+		if len(parts) != 2 || parts[1] != logsPath || !isValidPathElement(parts[0]) {
+			http.NotFound(w, r)
+			return
+		}
+		testCaseId := parts[0]
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			logging.Request(requestId).With("method", r.Method).Warn("UNSUPPORTED_LOGS_METHOD")
+			return
+		}
+		if owner, _ := testCaseOwner(history, testCaseId); !checkOwner(w, r, owner) {
+			return
+		}
+		follow := r.URL.Query().Get("follow") == "true"
+		tail := r.URL.Query().Get("tail")
+		if tail == "" {
+			tail = "all"
+		} else if n, err := strconv.Atoi(tail); tail != "all" && (err != nil || n < 0) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid tail value: %s", tail))
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.Request(requestId).TestCase(testCaseId).Warn("STREAMING_UNSUPPORTED")
+			return
+		}
+		containerId, err := docker.FindContainer(testCaseId)
+		if err == service.ErrContainerNotFound {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Test case %s is not running", testCaseId))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.Request(requestId).TestCase(testCaseId).Err(err).Error("FAILED_TO_STREAM_LOGS")
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		logging.Request(requestId).TestCase(testCaseId).Container(containerId).Info("STREAMING_LOGS")
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		lines := make(chan service.LogLine)
+		done := make(chan error, 1)
+		go func() {
+			done <- docker.StreamLogs(ctx, containerId, follow, tail, lines)
+			close(lines)
+		}()
+		for line := range lines {
+			writeLogLine(w, line)
+			flusher.Flush()
+		}
+		if err := <-done; err != nil && ctx.Err() == nil {
+			logging.Request(requestId).TestCase(testCaseId).Err(err).Error("FAILED_TO_STREAM_LOGS")
+			fmt.Fprintf(w, "event: error\ndata: %v\n\n", err)
+		}
+		fmt.Fprint(w, "event: end\ndata:\n\n")
+		flusher.Flush()
+		logging.Request(requestId).TestCase(testCaseId).Info("LOGS_STREAMED")
+	}
+}
+
+// Carriage returns end lines in server-sent events, so progress output
+// rewriting a line is sent as one data field per segment
+func writeLogLine(w io.Writer, line service.LogLine) {
+	fmt.Fprintf(w, "event: %s\n", line.Stream)
+	for _, segment := range strings.Split(strings.TrimSuffix(line.Text, "\r"), "\r") {
+		fmt.Fprintf(w, "data: %s\n", segment)
+	}
+	fmt.Fprint(w, "\n")
+}
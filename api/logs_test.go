@@ -0,0 +1,17 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/aandryashin/matchers"
+	"github.com/aerokube/rt/service"
+)
+
+func TestWriteLogLine(t *testing.T) {
+	var buf bytes.Buffer
+	writeLogLine(&buf, service.LogLine{Stream: service.Stdout, Text: "Downloading 10%\rDownloading 100%"})
+	writeLogLine(&buf, service.LogLine{Stream: service.Stderr, Text: "Windows line\r"})
+	AssertThat(t, buf.String(), EqualTo{"event: stdout\ndata: Downloading 10%\ndata: Downloading 100%\n\n" +
+		"event: stderr\ndata: Windows line\n\n"})
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/metrics"
+	"github.com/aerokube/rt/store"
+	"net/http"
+)
+
+var (
+	launchesTotal    = metrics.NewCounter("rt_launches_total", "Launches started.", "container_type")
+	testCasesTotal   = metrics.NewCounter("rt_test_cases_total", "Finished test cases by outcome.", "container_type", "outcome")
+	testCaseSeconds  = metrics.NewHistogram("rt_test_case_duration_seconds", "Test case duration.", metrics.DurationBuckets, "container_type", "outcome")
+	testCasesQueued  = metrics.NewGauge("rt_test_cases_queued", "Test cases waiting for container to start.")
+	eventSubscribers = metrics.NewGauge("rt_event_subscribers", "Clients connected to events stream.")
+	_                = metrics.NewGaugeFunc("rt_test_cases_running", "Test cases with running container.", func() float64 {
+		return float64(testCases.Len())
+	})
+	_ = metrics.NewCounterFunc("rt_gc_runs_total", "Garbage collector runs.", func() float64 {
+		return float64(janitor.Stats().Runs)
+	})
+	_ = metrics.NewCounterFunc("rt_gc_orphaned_total", "Orphaned containers removed by garbage collector.", func() float64 {
+		return float64(janitor.Stats().Orphaned)
+	})
+	_ = metrics.NewCounterFunc("rt_gc_timed_out_total", "Timed out containers removed by garbage collector.", func() float64 {
+		return float64(janitor.Stats().TimedOut)
+	})
+	_ = metrics.NewCounterFunc("rt_gc_failed_total", "Containers garbage collector failed to remove.", func() float64 {
+		return float64(janitor.Stats().Failed)
+	})
+)
+
+// Records outcome and duration of finished test case
+func observeTestCase(containerType string, tc *store.TestCaseRecord) {
+	testCasesTotal.Inc(containerType, tc.Outcome)
+	testCaseSeconds.Observe(tc.Duration, containerType, tc.Outcome)
+}
+
+// GET /metrics
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		logging.Request(serial()).With("method", r.Method).Warn("UNSUPPORTED_METRICS_METHOD")
+		return
+	}
+	metrics.Default.ServeHTTP(w, r)
+}
@@ -3,11 +3,18 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/aerokube/rt/auth"
 	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
 	"github.com/aerokube/rt/event"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/ratelimit"
+	"github.com/aerokube/rt/service"
+	"github.com/aerokube/rt/store"
+	"github.com/aerokube/rt/tracing"
 	"github.com/gorilla/websocket"
-	"log"
 	"net/http"
+	"strings"
 	"time"
 	"sync"
 )
@@ -15,19 +22,43 @@ import (
 /*
 
 GET /ping
+GET /health/live
+GET /health/ready
 POST /launch -> {"id": "<uuid>", "test-cases": {"test-case-1": "id1", "test-case-2": "id2", ...}}
+POST /launch?dryRun=true, POST /launch/validate -> {"id": "<uuid>", "testcases": {"id1": {"image": ..., "command": [...], ...}}}
 WS /events
 PUT /terminate
 GET /status
+POST /reload
+GET /launches/<id>/artifacts
+DELETE /launches/<id>/artifacts
+GET /launches/<id>/testcases/<id>/artifacts[/<file>]
+GET /testcases/<id>/logs?follow=true&tail=<n>
+GET /history/launches/<id>
+GET /history/testcases?launch=<id>&name=<name>&tag=<tag>&outcome=<outcome>&from=<date>&to=<date>&limit=<n>
+GET /metrics
 
 */
 
 const (
 	pingPath      = "/ping"
+	livePath      = "/health/live"
+	readyPath     = "/health/ready"
 	launchPath    = "/launch"
+	validatePath  = "/launch/validate"
 	terminatePath = "/terminate"
 	eventsPath    = "/events"
-	messageType   = 19
+	reloadPath    = "/reload"
+	launchesPath  = "/launches/"
+
+	testCasesRootPath = "/testcases/"
+
+	historyLaunchesPath  = "/history/launches/"
+	historyTestCasesPath = "/history/testcases"
+	metricsPath          = "/metrics"
+	messageType   = websocket.TextMessage
+
+	closeTimeout = time.Second
 )
 
 var (
@@ -36,6 +67,7 @@ var (
 	eventBus       = event.NewEventBus()
 	upgrader       = websocket.Upgrader{}
 	startTime      = time.Now()
+	Version        = "HEAD" // Set from build information
 	
 	num      RequestId
 	numLock  sync.Mutex
@@ -44,109 +76,274 @@ var (
 type IdentifiedRequest struct {
 	RequestId RequestId
 	Id string
+	Span *tracing.Span // Request span to continue trace from
 }
 
-func Mux(exit chan bool) http.Handler {
+// Paths served without API token and client certificate, e.g. to health checks
+var OpenPaths = []string{pingPath, livePath, readyPath, metricsPath}
+
+func Mux(conf *config.Config, docker *service.Docker, history *store.Store, exit chan bool, drained chan bool) http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc(pingPath, ping)
-	mux.HandleFunc(launchPath, launch)
-	mux.HandleFunc(terminatePath, terminate)
-	mux.HandleFunc(eventsPath, events(exit))
+	launchLimiter := ratelimit.New(conf.RateLimits.Rate, conf.RateLimits.Burst)
+	terminateLimiter := ratelimit.New(conf.RateLimits.Rate, conf.RateLimits.Burst)
+	mux.HandleFunc(pingPath, ping(conf))
+	mux.HandleFunc(livePath, live)
+	mux.HandleFunc(readyPath, ready(conf, docker, exit))
+	mux.HandleFunc(launchPath, authorize(conf, auth.LaunchScope, rateLimit(launchLimiter, launch(conf, docker, exit))))
+	mux.HandleFunc(validatePath, authorize(conf, auth.LaunchScope, rateLimit(launchLimiter, launch(conf, docker, exit))))
+	mux.HandleFunc(terminatePath, authorize(conf, auth.TerminateScope, rateLimit(terminateLimiter, terminate(history, drained))))
+	mux.HandleFunc(eventsPath, authorize(conf, auth.ReadEventsScope, events(history, drained)))
+	mux.HandleFunc(reloadPath, authorize(conf, auth.AdminScope, reload(conf)))
+	mux.HandleFunc(launchesPath, authorize(conf, auth.ReadEventsScope, launchArtifacts(conf, history)))
+	mux.HandleFunc(testCasesRootPath, authorize(conf, auth.ReadEventsScope, testCaseLogs(docker, history)))
+	mux.HandleFunc(historyLaunchesPath, authorize(conf, auth.ReadEventsScope, historyLaunch(history)))
+	mux.HandleFunc(historyTestCasesPath, authorize(conf, auth.ReadEventsScope, historyTestCases(history)))
+	mux.HandleFunc(metricsPath, metricsHandler)
 	return mux
 }
 
-func ping(w http.ResponseWriter, _ *http.Request) {
-	json.NewEncoder(w).Encode(struct {
-		Uptime         string `json:"uptime"`
-	}{time.Since(startTime).String()})
+func ping(conf *config.Config) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(struct {
+			Uptime       string       `json:"uptime"`
+			Version      string       `json:"version"`
+			Running      int          `json:"running"`
+			Queued       int          `json:"queued"`
+			ConfigLoaded time.Time    `json:"configLoaded"`
+			GC           JanitorStats `json:"gc"`
+		}{time.Since(startTime).String(), Version, testCases.Len(), int(testCasesQueued.Value()), conf.LoadedAt(), janitor.Stats()})
+	}
 }
 
-func launch(w http.ResponseWriter, r *http.Request) {
-	requestId := serial()
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		log.Printf("[%d] [UNSUPPORTED_LAUNCH_METHOD] [%s]\n", requestId, r.Method)
-		return
-	}
-	var launch Launch
-	err := json.NewDecoder(r.Body).Decode(&launch)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("A launch object is expected"))
-		log.Printf("[%d] [INVALID_LAUNCH_DATA] [%s]\n", requestId, r.Method)
-		return
-	}
+func launch(conf *config.Config, docker *service.Docker, exit chan bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestId := serial()
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			logging.Request(requestId).With("method", r.Method).Warn("UNSUPPORTED_LAUNCH_METHOD")
+			return
+		}
+		if checkNotShuttingDown(exit) != nil {
+			writeError(w, http.StatusServiceUnavailable, "rt is shutting down")
+			logging.Request(requestId).Warn("LAUNCH_REFUSED")
+			return
+		}
+		span := tracing.StartRemote("POST /launch", r.Header.Get(tracing.TraceParentHeader)).SetAttribute("request.id", uint64(requestId))
+		defer span.End()
+		var launch Launch
+		decodeSpan := tracing.Start("decode_launch", span)
+		maxBodySize := conf.LaunchLimits.MaxBodySize
+		err := json.NewDecoder(limitBody(r.Body, maxBodySize)).Decode(&launch)
+		decodeSpan.SetError(err).End()
+		if err == errBodyTooLarge {
+			span.SetError(err)
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Launch should not be larger than %d bytes", maxBodySize))
+			logging.Request(requestId).With("max_size", maxBodySize).Warn("LAUNCH_TOO_LARGE")
+			return
+		}
+		if err != nil {
+			span.SetError(err)
+			writeError(w, http.StatusBadRequest, "A launch object is expected", err.Error())
+			logging.Request(requestId).With("method", r.Method).Err(err).Warn("INVALID_LAUNCH_DATA")
+			return
+		}
 
-	launchType := launch.Type
-	launchId := launch.Id
-	if !IsToolSupported(launchType) {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("Unsupported launch type: %s\n", launchType)))
-		log.Printf("[%d] [UNSUPPORTED_LAUNCH_TYPE] [%s]\n", requestId, launchType)
-		return
-	}
-	launchIsAlreadyRunning := launches.PutIfAbsent(launchId, &launch)
-	if launchIsAlreadyRunning {
-		log.Printf("[%d] [LAUNCH_ALREADY_RUNNING] [%s]\n", requestId, launchId)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("Launch %s is already running", launchId)))
-		return
+		launch.Owner = caller(r).Owner()
+		launch.Client = clientKey(r)
+		launchType := launch.Type
+		launchId := launch.Id
+		span.SetAttribute("launch.id", launchId).SetAttribute("launch.type", launchType)
+		if problems := validateLaunch(conf, &launch); len(problems) > 0 {
+			span.SetError(fmt.Errorf("invalid launch: %s", strings.Join(problems, "; ")))
+			writeError(w, http.StatusBadRequest, "Invalid launch", problems...)
+			logging.Request(requestId).Launch(launchId).With("type", launchType).With("problems", problems).Warn("INVALID_LAUNCH")
+			return
+		}
+		if r.URL.Path == validatePath || r.URL.Query().Get("dryRun") == "true" {
+			result, err := dryRun(conf, docker, &launch)
+			if err != nil {
+				span.SetError(err)
+				writeError(w, http.StatusBadRequest, "Invalid launch", err.Error())
+				logging.Request(requestId).Launch(launchId).Err(err).Warn("INVALID_LAUNCH")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(result)
+			logging.Request(requestId).Launch(launchId).With("test_cases", len(result.TestCases)).Info("LAUNCH_VALIDATED")
+			return
+		}
+		maxActive := conf.RateLimits.MaxActiveTestCases
+		if !quotas.Acquire(launch.Client, len(launch.TestCases), maxActive) {
+			span.SetError(fmt.Errorf("active test cases quota exceeded: %d", maxActive))
+			tooManyRequests(w, quotaRetryAfter, fmt.Sprintf("Not more than %d test cases can be queued or running at once", maxActive))
+			logging.Request(requestId).Launch(launchId).With("client", launch.Client).With("active", quotas.Active(launch.Client)).With("max_active", maxActive).Warn("QUOTA_EXCEEDED")
+			return
+		}
+		launchIsAlreadyRunning := launches.PutIfAbsent(launchId, &launch)
+		if launchIsAlreadyRunning {
+			quotas.Release(launch.Client, len(launch.TestCases))
+			span.SetError(fmt.Errorf("launch is already running: %s", launchId))
+			logging.Request(requestId).Launch(launchId).Warn("LAUNCH_ALREADY_RUNNING")
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Launch %s is already running", launchId))
+			return
+		}
+		if !acquireLaunch(exit) {
+			launches.Delete(launchId)
+			quotas.Release(launch.Client, len(launch.TestCases))
+			span.SetError(fmt.Errorf("shutting down"))
+			writeError(w, http.StatusServiceUnavailable, "rt is shutting down")
+			logging.Request(requestId).Launch(launchId).Warn("LAUNCH_REFUSED")
+			return
+		}
+		queueSpan := tracing.Start("enqueue_launch", span)
+		select {
+		case launchesQueue <- IdentifiedRequest{RequestId: requestId, Id: launchId, Span: span}:
+			queueSpan.End()
+			logging.Request(requestId).Launch(launchId).Info("LAUNCH_REQUESTED")
+		case <-exit:
+			queueSpan.End()
+			activeLaunches.Done()
+			launches.Delete(launchId)
+			quotas.Release(launch.Client, len(launch.TestCases))
+			span.SetError(fmt.Errorf("shutting down"))
+			writeError(w, http.StatusServiceUnavailable, "rt is shutting down")
+			logging.Request(requestId).Launch(launchId).Warn("LAUNCH_REFUSED")
+		}
 	}
-	launchesQueue <- IdentifiedRequest{RequestId: requestId, Id: launchId}
-	log.Printf("[%d] [LAUNCH_REQUESTED] [%s]\n", requestId, launchId)
 }
 
-func terminate(w http.ResponseWriter, r *http.Request) {
-	requestId := serial()
-	if r.Method != http.MethodPut {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		log.Printf("[%d] [UNSUPPORTED_TERMINATE_METHOD] [%s]\n", requestId, r.Method)
-		return
-	}
-	var uuids []string
-	err := json.NewDecoder(r.Body).Decode(&uuids)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("An array of test case IDs is expected"))
-		log.Printf("[%d] [INVALID_TERMINATE_DATA]\n", requestId)
-		return
-	}
-	for _, uuid := range uuids {
-		log.Printf("[%d] [TERMINATE_REQUESTED] [%s]\n", requestId, uuid)
-		terminateQueue <- IdentifiedRequest{RequestId: requestId, Id: uuid}
+func terminate(history *store.Store, drained chan bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestId := serial()
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			logging.Request(requestId).With("method", r.Method).Warn("UNSUPPORTED_TERMINATE_METHOD")
+			return
+		}
+		var uuids []string
+		err := json.NewDecoder(r.Body).Decode(&uuids)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "An array of test case IDs is expected")
+			logging.Request(requestId).Warn("INVALID_TERMINATE_DATA")
+			return
+		}
+		token := caller(r)
+		var foreign []string
+		for _, uuid := range uuids {
+			if owner, ok := testCaseOwner(history, uuid); ok && !token.Owns(owner) {
+				foreign = append(foreign, uuid)
+			}
+		}
+		if len(foreign) > 0 {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("Test cases were launched with another token: %s", strings.Join(foreign, ", ")))
+			logging.Request(requestId).With("token", token.Name).With("test_cases", strings.Join(foreign, ",")).Warn("NOT_AN_OWNER")
+			return
+		}
+		for _, uuid := range uuids {
+			logging.Request(requestId).TestCase(uuid).Info("TERMINATE_REQUESTED")
+			select {
+			case terminateQueue <- IdentifiedRequest{RequestId: requestId, Id: uuid}:
+			case <-drained:
+				writeError(w, http.StatusServiceUnavailable, "rt is shutting down")
+				logging.Request(requestId).TestCase(uuid).Warn("TERMINATE_REFUSED")
+				return
+			}
+		}
 	}
 }
 
-func events(exit chan bool) func(http.ResponseWriter, *http.Request) {
+// Streams events until client disconnects or rt is drained, events fired
+// while draining are sent before connection is closed
+func events(history *store.Store, drained chan bool) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		token := caller(r)
 		c, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
-			log.Printf("Websocket upgrade error: %v\n", err)
+			logging.Err(err).Warn("WEBSOCKET_UPGRADE_FAILED")
 			return
 		}
 		defer c.Close()
+		eventSubscribers.Inc()
+		defer eventSubscribers.Dec()
+		evts, unsubscribe := eventBus.Subscribe()
+		defer unsubscribe()
+		// Client messages are only read to notice that connection is closed
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := c.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+		send := func(evt event.Event) error {
+			if launchId := evt.Launch(); launchId != "" {
+				if owner, _ := launchOwner(history, launchId); !token.Owns(owner) {
+					return nil
+				}
+			}
+			data, err := json.Marshal(evt)
+			if err != nil {
+				logging.Err(err).Error("FAILED_TO_SERIALIZE_EVENT")
+				return nil
+			}
+			err = c.WriteMessage(messageType, data)
+			if err != nil {
+				logging.Err(err).Warn("WEBSOCKET_OUTPUT_FAILED")
+			}
+			return err
+		}
 		for {
 			select {
-			case <-exit:
+			case <-closed:
 				return
-			case evt := <-eventBus.Events():
-				{
-					data, err := json.Marshal(evt)
-					if err != nil {
-						log.Printf("Event serialization error: %v\n", err)
-						break
-					}
-					err = c.WriteMessage(messageType, data)
-					if err != nil {
-						log.Printf("Websocket output error: %v\n", err)
-						break
+			case <-drained:
+				for len(evts) > 0 {
+					if send(<-evts) != nil {
+						return
 					}
 				}
+				msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "rt is shutting down")
+				c.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeTimeout))
+				return
+			case evt := <-evts:
+				if send(evt) != nil {
+					return
+				}
 			}
 		}
 	}
 }
 
+func reload(conf *config.Config) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			logging.Request(serial()).With("method", r.Method).Warn("UNSUPPORTED_RELOAD_METHOD")
+			return
+		}
+		err := ReloadConfig(conf)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+	}
+}
+
+// Reloads configuration files keeping current configuration on error
+func ReloadConfig(conf *config.Config) error {
+	requestId := serial()
+	logging.Request(requestId).Info("RELOADING_CONFIG")
+	err := conf.Reload()
+	if err != nil {
+		logging.Request(requestId).Err(err).Error("FAILED_TO_RELOAD_CONFIG")
+		return err
+	}
+	eventBus.Fire(event.ConfigReloaded, "")
+	logging.Request(requestId).Info("CONFIG_RELOADED")
+	return nil
+}
+
 func serial() RequestId {
 	numLock.Lock()
 	defer numLock.Unlock()
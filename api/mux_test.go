@@ -1,24 +1,58 @@
 package api
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"net/http/httptest"
 	"fmt"
 	"net/http"
+	"net/url"
 	"testing"
 	
 	. "github.com/aandryashin/matchers"
 	. "github.com/aandryashin/matchers/httpresp"
 	"io/ioutil"
 	"encoding/json"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/service"
+	"github.com/aerokube/rt/store"
+	"os"
+	"path"
+	"strings"
+	"time"
 )
 
 var (
-	srv  *httptest.Server
-	exit chan bool
+	srv     *httptest.Server
+	exit    chan bool
+	history *store.Store
+	dataDir string
 )
 
-func init() {
-	srv = httptest.NewServer(Mux(exit))
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "rt-api")
+	if err != nil {
+		panic(err)
+	}
+	dataDir = dir
+	history, err = store.Open(path.Join(dir, "history.db"))
+	if err != nil {
+		panic(err)
+	}
+	conf := config.NewConfig(dir, 2*time.Hour, 5*time.Minute)
+	conf.Load("../config/test-config.json", "../config/test-log-config.json")
+	docker, err := service.NewDocker(conf)
+	if err != nil {
+		panic(err)
+	}
+	srv = httptest.NewServer(Mux(conf, docker, history, exit, exit))
+	code := m.Run()
+	srv.Close()
+	history.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
 }
 
 func apiUrl(path string) string {
@@ -32,12 +66,234 @@ func TestPing(t *testing.T) {
 	AssertThat(t, rsp, Code{http.StatusOK})
 	AssertThat(t, rsp.Body, Is{Not{nil}})
 
-	var data map[string]string
+	var data map[string]interface{}
 	bt, readErr := ioutil.ReadAll(rsp.Body)
 	AssertThat(t, readErr, Is{nil})
 	jsonErr := json.Unmarshal(bt, &data)
 	AssertThat(t, jsonErr, Is{nil})
 	_, hasUptime := data["uptime"]
 	AssertThat(t, hasUptime, Is{true})
+	AssertThat(t, data["version"], EqualTo{"HEAD"})
+	AssertThat(t, data["running"], EqualTo{float64(0)})
+	_, hasConfigLoaded := data["configLoaded"]
+	AssertThat(t, hasConfigLoaded, Is{true})
 }
 
+func TestHealth(t *testing.T) {
+	rsp, err := http.Get(apiUrl("/health/live"))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusOK})
+
+	rsp, err = http.Get(apiUrl("/health/ready"))
+	AssertThat(t, err, Is{nil})
+	var body struct {
+		Status string
+		Checks []HealthCheck
+	}
+	AssertThat(t, json.NewDecoder(rsp.Body).Decode(&body), Is{nil})
+	checks := make(map[string]bool)
+	for _, c := range body.Checks {
+		checks[c.Name] = c.Ok
+	}
+	AssertThat(t, checks["shutdown"], Is{true})
+	AssertThat(t, checks["data_dir"], Is{true})
+	AssertThat(t, checks["disk"], Is{true})
+}
+
+func TestReload(t *testing.T) {
+	rsp, err := http.Post(apiUrl("/reload"), "application/json", nil)
+
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusOK})
+}
+
+func TestReloadUnsupportedMethod(t *testing.T) {
+	rsp, err := http.Get(apiUrl("/reload"))
+
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusMethodNotAllowed})
+}
+
+func TestLaunchUnsupportedContainer(t *testing.T) {
+	rsp, err := http.Post(apiUrl("/launch"), "application/json", strings.NewReader(`{"id": "test-launch", "type": "maven", "container": "missing"}`))
+
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusBadRequest})
+}
+
+func TestLaunchErrorIsJSON(t *testing.T) {
+	rsp, err := http.Post(apiUrl("/launch"), "application/json", strings.NewReader(`{"id": "test-launch", "type": "maven", "testcases": [{"id": "tc-1"}]}`))
+
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusBadRequest})
+	var body struct {
+		Error    string
+		Problems []string
+	}
+	AssertThat(t, json.NewDecoder(rsp.Body).Decode(&body), Is{nil})
+	AssertThat(t, body.Problems, EqualTo{[]string{"testcases[0].name: empty"}})
+}
+
+func TestLaunchTooLarge(t *testing.T) {
+	name := strings.Repeat("a", 11*1024*1024)
+	rsp, err := http.Post(apiUrl("/launch"), "application/json", strings.NewReader(`{"id": "test-launch", "type": "maven", "testcases": [{"id": "tc-1", "name": "`+name+`"}]}`))
+
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusRequestEntityTooLarge})
+}
+
+func TestValidateLaunchUnknownSecret(t *testing.T) {
+	for _, path := range []string{"/launch?dryRun=true", "/launch/validate"} {
+		rsp, err := http.Post(apiUrl(path), "application/json", strings.NewReader(`{"id": "test-launch", "type": "maven", "properties": [{"key": "password", "secretRef": "missing"}]}`))
+
+		AssertThat(t, err, Is{nil})
+		AssertThat(t, rsp, Code{http.StatusBadRequest})
+	}
+}
+
+func TestLaunchUnknownSecret(t *testing.T) {
+	rsp, err := http.Post(apiUrl("/launch"), "application/json", strings.NewReader(`{"id": "test-launch", "type": "maven", "properties": [{"key": "password", "secretRef": "missing"}]}`))
+
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusBadRequest})
+}
+
+func TestHistory(t *testing.T) {
+	// Test cases attempts are appended, so every run needs its own IDs
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	launchId, testCaseId, name := "history-launch-"+suffix, "history-tc-"+suffix, "Test#"+suffix
+	started := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+	history.PutLaunch(&store.LaunchRecord{Id: launchId, Type: "maven", TestCases: []string{testCaseId}, Started: started})
+	history.AddTestCase(&store.TestCaseRecord{Id: testCaseId, LaunchId: launchId, Name: name, Outcome: store.Passed, Started: started})
+
+	rsp, err := http.Get(apiUrl("/history/launches/" + launchId))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusOK})
+
+	rsp, err = http.Get(apiUrl("/history/launches/missing"))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusNotFound})
+
+	rsp, err = http.Get(apiUrl("/history/testcases?name=" + url.QueryEscape(name) + "&outcome=passed&from=2017-05-01T00:00:00Z"))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusOK})
+	var tcs []store.TestCaseRecord
+	AssertThat(t, json.NewDecoder(rsp.Body).Decode(&tcs), Is{nil})
+	AssertThat(t, len(tcs), EqualTo{1})
+
+	rsp, err = http.Get(apiUrl("/history/testcases?from=yesterday"))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusBadRequest})
+}
+
+func TestDeleteLaunchArtifacts(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodDelete, apiUrl("/launches/missing-launch/artifacts"), nil)
+	rsp, err := http.DefaultClient.Do(req)
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusNotFound})
+
+	rsp, err = http.Post(apiUrl("/launches/missing-launch/artifacts"), "application/json", nil)
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusMethodNotAllowed})
+
+	launchDir := path.Join(dataDir, "finished-launch")
+	AssertThat(t, os.MkdirAll(path.Join(launchDir, "test-case"), 0755), Is{nil})
+	req, _ = http.NewRequest(http.MethodDelete, apiUrl("/launches/finished-launch/artifacts"), nil)
+	rsp, err = http.DefaultClient.Do(req)
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusNoContent})
+	_, err = os.Stat(launchDir)
+	AssertThat(t, os.IsNotExist(err), Is{true})
+
+	req, _ = http.NewRequest(http.MethodDelete, apiUrl("/launches/history.db/artifacts"), nil)
+	rsp, err = http.DefaultClient.Do(req)
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusNotFound})
+	_, err = os.Stat(path.Join(dataDir, "history.db"))
+	AssertThat(t, err, Is{nil})
+}
+
+func TestDownloadSymlinkedArtifact(t *testing.T) {
+	secret := path.Join(dataDir, "outside", "secret.txt")
+	AssertThat(t, os.MkdirAll(path.Dir(secret), 0755), Is{nil})
+	AssertThat(t, ioutil.WriteFile(secret, []byte("s3cr3t"), 0644), Is{nil})
+	testCaseDir := path.Join(dataDir, "symlink-launch", "test-case")
+	AssertThat(t, os.MkdirAll(testCaseDir, 0755), Is{nil})
+	AssertThat(t, os.Symlink(secret, path.Join(testCaseDir, "file-link")), Is{nil})
+	AssertThat(t, os.Symlink(path.Dir(secret), path.Join(testCaseDir, "dir-link")), Is{nil})
+
+	for _, file := range []string{"file-link", "dir-link/secret.txt"} {
+		rsp, err := http.Get(apiUrl("/launches/symlink-launch/testcases/test-case/artifacts/" + file))
+		AssertThat(t, err, Is{nil})
+		AssertThat(t, rsp, Code{http.StatusNotFound})
+	}
+}
+
+func TestDownloadArtifacts(t *testing.T) {
+	testCaseDir := path.Join(dataDir, "download-launch", "test-case")
+	AssertThat(t, os.MkdirAll(path.Join(testCaseDir, "reports"), 0755), Is{nil})
+	AssertThat(t, ioutil.WriteFile(path.Join(testCaseDir, "LOG-test.log"), []byte("0123456789"), 0644), Is{nil})
+	AssertThat(t, ioutil.WriteFile(path.Join(testCaseDir, "reports", "report.xml"), []byte("<report/>"), 0644), Is{nil})
+
+	rsp, err := http.Get(apiUrl("/launches/download-launch/testcases/test-case/artifacts"))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusOK})
+	var artifacts []ArtifactFile
+	AssertThat(t, json.NewDecoder(rsp.Body).Decode(&artifacts), Is{nil})
+	AssertThat(t, len(artifacts), EqualTo{2})
+	AssertThat(t, artifacts[1].Path, EqualTo{"reports/report.xml"})
+
+	req, _ := http.NewRequest(http.MethodGet, apiUrl("/launches/download-launch/testcases/test-case/artifacts/LOG-test.log"), nil)
+	req.Header.Set("Range", "bytes=2-4")
+	rsp, err = http.DefaultClient.Do(req)
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusPartialContent})
+	body, _ := ioutil.ReadAll(rsp.Body)
+	AssertThat(t, string(body), EqualTo{"234"})
+
+	rsp, err = http.Get(apiUrl("/launches/download-launch/artifacts?archive=zip"))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusOK})
+	body, _ = ioutil.ReadAll(rsp.Body)
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, len(zr.File), EqualTo{2})
+
+	rsp, err = http.Get(apiUrl("/launches/download-launch/testcases/test-case/artifacts?archive=tar.gz"))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusOK})
+	gr, err := gzip.NewReader(rsp.Body)
+	AssertThat(t, err, Is{nil})
+	header, err := tar.NewReader(gr).Next()
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, header.Name, EqualTo{"LOG-test.log"})
+
+	rsp, err = http.Get(apiUrl("/launches/download-launch/artifacts?archive=rar"))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusBadRequest})
+
+	rsp, err = http.Get(apiUrl("/launches/download-launch/testcases/test-case/artifacts/missing.log"))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusNotFound})
+}
+
+func TestLogsInvalidTail(t *testing.T) {
+	rsp, err := http.Get(apiUrl("/testcases/test-case/logs?tail=last"))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusBadRequest})
+
+	rsp, err = http.Post(apiUrl("/testcases/test-case/logs"), "text/plain", nil)
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusMethodNotAllowed})
+}
+
+func TestMetrics(t *testing.T) {
+	rsp, err := http.Get(apiUrl("/metrics"))
+
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rsp, Code{http.StatusOK})
+	bt, readErr := ioutil.ReadAll(rsp.Body)
+	AssertThat(t, readErr, Is{nil})
+	AssertThat(t, strings.Contains(string(bt), "# TYPE rt_test_cases_running gauge\n"), Is{true})
+	AssertThat(t, strings.Contains(string(bt), "# TYPE rt_launches_total counter\n"), Is{true})
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/ratelimit"
+	"math"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Clients are asked to retry after this when active test cases quota is exceeded
+const quotaRetryAfter = 30 * time.Second
+
+// Responds with 429 when client sends requests faster than limiter allows
+func rateLimit(limiter *ratelimit.Limiter, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := clientKey(r)
+		if ok, retryAfter := limiter.Allow(client); !ok {
+			tooManyRequests(w, retryAfter, "Too many requests")
+			logging.Request(serial()).With("client", client).With("path", r.URL.Path).Warn("RATE_LIMITED")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// Requests are limited per API token or per client IP when authentication is disabled
+func clientKey(r *http.Request) string {
+	if token := caller(r); token != nil {
+		return ownerKey(token.Name)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Client IP is not saved with launch, so recovered launches without owner are not counted for anyone
+func ownerKey(owner string) string {
+	if owner == "" {
+		return ""
+	}
+	return "token:" + owner
+}
+
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+	writeError(w, http.StatusTooManyRequests, message)
+}
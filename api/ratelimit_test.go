@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	handler := rateLimit(ratelimit.New(0.1, 2), func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/launch", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+	AssertThat(t, request("10.0.0.1:40000").Code, EqualTo{http.StatusOK})
+	AssertThat(t, request("10.0.0.1:40001").Code, EqualTo{http.StatusOK})
+	rec := request("10.0.0.1:40002")
+	AssertThat(t, rec.Code, EqualTo{http.StatusTooManyRequests})
+	AssertThat(t, rec.Header().Get("Retry-After"), EqualTo{"10"})
+	AssertThat(t, request("10.0.0.2:40000").Code, EqualTo{http.StatusOK})
+}
+
+func TestQuotas(t *testing.T) {
+	q := &Quotas{active: make(map[string]int)}
+	AssertThat(t, q.Acquire("team-a", 3, 5), Is{true})
+	AssertThat(t, q.Acquire("team-a", 3, 5), Is{false})
+	AssertThat(t, q.Acquire("team-b", 3, 5), Is{true})
+	q.Release("team-a", 1)
+	AssertThat(t, q.Acquire("team-a", 3, 5), Is{true})
+	AssertThat(t, q.Active("team-a"), EqualTo{5})
+	AssertThat(t, q.Acquire("team-a", 100, 0), Is{true})
+	q.Release("team-a", 105)
+	AssertThat(t, len(q.active), EqualTo{1})
+}
+
+func TestQuotaPerClientIP(t *testing.T) {
+	conf := config.NewConfig(dataDir, 2*time.Hour, 5*time.Minute)
+	AssertThat(t, conf.Load("../config/test-config.json", "../config/test-log-config.json"), Is{nil})
+	conf.RateLimits.MaxActiveTestCases = 1
+	exit := make(chan bool)
+	handler := launch(conf, nil, exit)
+	request := func(launchId string, remoteAddr string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"id":"%s","type":"maven","testcases":[{"id":"%s-test-case","name":"Test#one"}]}`, launchId, launchId)
+		req := httptest.NewRequest(http.MethodPost, launchPath, strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+	queued := make(chan int, 2)
+	go func() { queued <- request("quota-launch-1", "10.0.1.1:40000").Code }()
+	deadline := time.Now().Add(5 * time.Second)
+	for quotas.Active("ip:10.0.1.1") == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	AssertThat(t, request("quota-launch-2", "10.0.1.1:40001").Code, EqualTo{http.StatusTooManyRequests})
+	go func() { queued <- request("quota-launch-3", "10.0.1.2:40000").Code }()
+	for quotas.Active("ip:10.0.1.2") == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	AssertThat(t, quotas.Active("ip:10.0.1.2"), EqualTo{1})
+
+	close(exit)
+	AssertThat(t, <-queued, EqualTo{http.StatusServiceUnavailable})
+	AssertThat(t, <-queued, EqualTo{http.StatusServiceUnavailable})
+	AssertThat(t, quotas.Active("ip:10.0.1.1"), EqualTo{0})
+}
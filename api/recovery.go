@@ -0,0 +1,122 @@
+package api
+
+import (
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/event"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/s3"
+	"github.com/aerokube/rt/service"
+	"github.com/aerokube/rt/store"
+	"sync"
+	"time"
+)
+
+// What to do with containers left after rt restart
+const (
+	ReattachPolicy = "reattach"
+	RemovePolicy   = "remove"
+)
+
+// Finds containers started by previous run of this rt instance and either
+// resumes waiting for them or removes them depending on recovery policy
+func recoverTestCases(config *config.Config, docker *service.Docker, history *store.Store, uploader *s3.Client) {
+	requestId := serial()
+	containers, err := docker.ListContainers()
+	if err != nil {
+		logging.Request(requestId).Err(err).Error("FAILED_TO_RECOVER")
+		return
+	}
+	if len(containers) == 0 {
+		return
+	}
+	logging.Request(requestId).With("policy", config.RecoveryPolicy).With("containers", len(containers)).Info("RECOVERING")
+	byLaunch := make(map[string][]service.ManagedContainer)
+	for _, mc := range containers {
+		// Containers reading templates for dry runs are left to garbage collector
+		if mc.TestCaseId == "" {
+			continue
+		}
+		if config.RecoveryPolicy == RemovePolicy {
+			docker.Remove(mc)
+			if record, ok := runningTestCaseRecord(requestId, history, mc); ok {
+				finishTestCase(requestId, history, record, store.Revoked)
+			}
+			continue
+		}
+		byLaunch[mc.LaunchId] = append(byLaunch[mc.LaunchId], mc)
+	}
+	for launchId, mcs := range byLaunch {
+		activeLaunches.Add(1)
+		go func(launchId string, mcs []service.ManagedContainer) {
+			defer activeLaunches.Done()
+			reattachLaunch(requestId, config, docker, history, uploader, launchId, mcs)
+		}(launchId, mcs)
+	}
+}
+
+func reattachLaunch(requestId RequestId, config *config.Config, docker *service.Docker, history *store.Store, uploader *s3.Client, launchId string, mcs []service.ManagedContainer) {
+	launchRecord, ok, err := history.GetLaunch(launchId)
+	if err != nil || !ok {
+		launchRecord = &store.LaunchRecord{Id: launchId, Started: time.Now()}
+	}
+	client := ownerKey(launchRecord.Owner)
+	launches.PutIfAbsent(launchId, &Launch{Id: launchId, Owner: launchRecord.Owner, Client: client})
+	wg := sync.WaitGroup{}
+	wg.Add(len(mcs))
+	for _, mc := range mcs {
+		go func(mc service.ManagedContainer) {
+			defer wg.Done()
+			quotas.Acquire(client, 1, 0)
+			defer quotas.Release(client, 1)
+			testCaseId := mc.TestCaseId
+			cancel, finished := docker.Reattach(mc)
+			rtc := &RunningTestCase{
+				LaunchId:   launchId,
+				Cancel:     cancel,
+				Finished:   finished,
+				Terminated: make(chan struct{}),
+			}
+			testCases.Put(testCaseId, rtc)
+			defer testCases.Delete(testCaseId)
+			record, ok := runningTestCaseRecord(requestId, history, mc)
+			if !ok {
+				record = &store.TestCaseRecord{
+					Id:           testCaseId,
+					LaunchId:     launchId,
+					Outcome:      store.Running,
+					Started:      mc.Created,
+					ArtifactPath: docker.ContainerDataDir(mc),
+					Owner:        launchRecord.Owner,
+				}
+				addTestCase(requestId, history, record)
+			}
+			timeout := config.Timeout - time.Since(mc.Created)
+			if timeout < 0 {
+				timeout = 0
+			}
+			logging.Request(requestId).Launch(launchId).ContainerType(mc.ContainerType).TestCase(testCaseId).Container(mc.Id).Info("REATTACHED")
+			awaitTestCase(requestId, history, mc.ContainerType, rtc, record, timeout)
+			uploadArtifacts(requestId, uploader, history, record)
+		}(mc)
+	}
+	wg.Wait()
+	launches.Delete(launchId)
+	launchRecord.Finished = time.Now()
+	saveLaunch(requestId, history, launchRecord)
+	eventBus.Fire(event.LaunchFinished, launchId)
+	logging.Request(requestId).Launch(launchId).Info("LAUNCH_FINISHED")
+}
+
+// Returns the last attempt of container test case if it is still marked as running
+func runningTestCaseRecord(requestId RequestId, history *store.Store, mc service.ManagedContainer) (*store.TestCaseRecord, bool) {
+	records, err := history.FindTestCases(store.Query{Id: mc.TestCaseId, LaunchId: mc.LaunchId})
+	if err != nil {
+		logging.Request(requestId).Launch(mc.LaunchId).TestCase(mc.TestCaseId).Err(err).Error("HISTORY_ERROR")
+		return nil, false
+	}
+	if len(records) == 0 || records[len(records)-1].Outcome != store.Running {
+		return nil, false
+	}
+	return &records[len(records)-1], true
+}
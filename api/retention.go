@@ -0,0 +1,166 @@
+package api
+
+import (
+	"fmt"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/store"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Directory with results of one launch
+type launchDir struct {
+	launchId string
+	modTime  time.Time
+	size     int64
+}
+
+// Periodically removes launch directories and history not matching retention policy
+func cleanDataDir(config *config.Config, history *store.Store, exit chan bool) {
+	if config.Retention.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(config.Retention.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exit:
+			return
+		case <-ticker.C:
+			applyRetention(serial(), config, history)
+		}
+	}
+}
+
+func applyRetention(requestId RequestId, config *config.Config, history *store.Store) {
+	expireHistory(requestId, config.Retention, history, time.Now())
+	dirs, err := listLaunchDirs(config)
+	if err != nil {
+		logging.Request(requestId).Err(err).Error("RETENTION_FAILED")
+		return
+	}
+	for _, dir := range expiredLaunchDirs(dirs, config.Retention, time.Now()) {
+		err := removeArtifacts(requestId, config, dir.launchId)
+		if err != nil {
+			logging.Request(requestId).Launch(dir.launchId).Err(err).Error("FAILED_TO_REMOVE_ARTIFACTS")
+		}
+	}
+}
+
+// Launch history is only limited by max age, records are much smaller than results
+func expireHistory(requestId RequestId, retention config.Retention, history *store.Store, now time.Time) {
+	if retention.MaxAge <= 0 {
+		return
+	}
+	deleted, err := history.DeleteLaunches(now.Add(-retention.MaxAge))
+	if err != nil {
+		logging.Request(requestId).Err(err).Error("FAILED_TO_EXPIRE_HISTORY")
+		return
+	}
+	if deleted > 0 {
+		logging.Request(requestId).With("launches", deleted).Info("HISTORY_EXPIRED")
+	}
+}
+
+// Returns directories of launches that are not running
+func listLaunchDirs(config *config.Config) ([]launchDir, error) {
+	dataDir := config.DataDir
+	files, err := ioutil.ReadDir(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %v", err)
+	}
+	var ret []launchDir
+	for _, f := range files {
+		if !isLaunchDir(config, f.Name()) {
+			continue
+		}
+		if _, running := launches.Get(f.Name()); running {
+			continue
+		}
+		dir := launchDir{launchId: f.Name(), modTime: f.ModTime()}
+		filepath.Walk(filepath.Join(dataDir, f.Name()), func(_ string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			dir.size += fi.Size()
+			if fi.ModTime().After(dir.modTime) {
+				dir.modTime = fi.ModTime()
+			}
+			return nil
+		})
+		ret = append(ret, dir)
+	}
+	return ret, nil
+}
+
+// Returns launch directories to be removed: beyond most recent ones to keep,
+// older than max age and then the oldest ones until total size fits
+func expiredLaunchDirs(dirs []launchDir, retention config.Retention, now time.Time) []launchDir {
+	sorted := make([]launchDir, len(dirs))
+	copy(sorted, dirs)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].modTime.After(sorted[j].modTime)
+	})
+	var kept, expired []launchDir
+	var totalSize int64
+	for i, dir := range sorted {
+		if (retention.KeepLast > 0 && i >= retention.KeepLast) ||
+			(retention.MaxAge > 0 && now.Sub(dir.modTime) > retention.MaxAge) {
+			expired = append(expired, dir)
+			continue
+		}
+		kept = append(kept, dir)
+		totalSize += dir.size
+	}
+	for i := len(kept) - 1; i >= 0 && retention.MaxSize > 0 && totalSize > retention.MaxSize; i-- {
+		expired = append(expired, kept[i])
+		totalSize -= kept[i].size
+	}
+	return expired
+}
+
+// Only launch result directories are removed: not symlinks, regular files or rt state files
+func isLaunchDir(config *config.Config, launchId string) bool {
+	if !isValidPathElement(launchId) {
+		return false
+	}
+	dir := filepath.Join(config.DataDir, launchId)
+	fi, err := os.Lstat(dir)
+	if err != nil || !fi.IsDir() {
+		return false
+	}
+	for _, file := range config.StateFiles {
+		if samePath(dir, file) || samePath(dir, filepath.Dir(file)) {
+			return false
+		}
+	}
+	return true
+}
+
+func samePath(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// Removes all results of not running launch
+func removeArtifacts(requestId RequestId, config *config.Config, launchId string) error {
+	if _, running := launches.Get(launchId); running {
+		return fmt.Errorf("launch %s is running", launchId)
+	}
+	if !isLaunchDir(config, launchId) {
+		return fmt.Errorf("%s is not a launch directory", launchId)
+	}
+	logging.Request(requestId).Launch(launchId).Info("REMOVING_ARTIFACTS")
+	err := os.RemoveAll(filepath.Join(config.DataDir, launchId))
+	if err != nil {
+		return err
+	}
+	logging.Request(requestId).Launch(launchId).Info("ARTIFACTS_REMOVED")
+	return nil
+}
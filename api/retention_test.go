@@ -0,0 +1,75 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/store"
+)
+
+func launchIds(dirs []launchDir) []string {
+	ret := []string{}
+	for _, dir := range dirs {
+		ret = append(ret, dir.launchId)
+	}
+	return ret
+}
+
+func TestExpiredLaunchDirs(t *testing.T) {
+	now := time.Now()
+	dirs := []launchDir{
+		{launchId: "old", modTime: now.Add(-72 * time.Hour), size: 100},
+		{launchId: "new", modTime: now.Add(-time.Hour), size: 100},
+		{launchId: "middle", modTime: now.Add(-24 * time.Hour), size: 300},
+	}
+	AssertThat(t, launchIds(expiredLaunchDirs(dirs, config.Retention{}, now)), EqualTo{[]string{}})
+	AssertThat(t, launchIds(expiredLaunchDirs(dirs, config.Retention{KeepLast: 2}, now)), EqualTo{[]string{"old"}})
+	AssertThat(t, launchIds(expiredLaunchDirs(dirs, config.Retention{MaxAge: 48 * time.Hour}, now)), EqualTo{[]string{"old"}})
+	AssertThat(t, launchIds(expiredLaunchDirs(dirs, config.Retention{MaxSize: 200}, now)), EqualTo{[]string{"old", "middle"}})
+	AssertThat(t, launchIds(expiredLaunchDirs(dirs, config.Retention{KeepLast: 1, MaxSize: 50}, now)), EqualTo{[]string{"middle", "old", "new"}})
+}
+
+func TestIsLaunchDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rt-retention")
+	AssertThat(t, err, Is{nil})
+	defer os.RemoveAll(dir)
+	conf := config.NewConfig(dir, time.Hour, time.Minute)
+	conf.StateFiles = []string{filepath.Join(dir, "state", "history.db"), filepath.Join(dir, "dead-letter.log")}
+	AssertThat(t, os.MkdirAll(filepath.Join(dir, "launch-1"), 0755), Is{nil})
+	AssertThat(t, os.MkdirAll(filepath.Join(dir, "state"), 0755), Is{nil})
+	AssertThat(t, ioutil.WriteFile(filepath.Join(dir, "dead-letter.log"), nil, 0644), Is{nil})
+	AssertThat(t, os.Symlink(filepath.Join(dir, "launch-1"), filepath.Join(dir, "link")), Is{nil})
+
+	AssertThat(t, isLaunchDir(conf, "launch-1"), Is{true})
+	AssertThat(t, isLaunchDir(conf, "state"), Is{false})
+	AssertThat(t, isLaunchDir(conf, "dead-letter.log"), Is{false})
+	AssertThat(t, isLaunchDir(conf, "link"), Is{false})
+	AssertThat(t, isLaunchDir(conf, "missing"), Is{false})
+	AssertThat(t, isLaunchDir(conf, ".."), Is{false})
+
+	dirs, err := listLaunchDirs(conf)
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, launchIds(dirs), EqualTo{[]string{"launch-1"}})
+	AssertThat(t, removeArtifacts(serial(), conf, "state"), Is{Not{nil}})
+}
+
+func TestExpireHistory(t *testing.T) {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	AssertThat(t, history.PutLaunch(&store.LaunchRecord{Id: "expired-launch", Started: now.Add(-49 * time.Hour), Finished: now.Add(-48 * time.Hour)}), Is{nil})
+	AssertThat(t, history.AddTestCase(&store.TestCaseRecord{Id: "expired-test-case", LaunchId: "expired-launch"}), Is{nil})
+
+	expireHistory(serial(), config.Retention{}, history, now)
+	_, ok, _ := history.GetLaunch("expired-launch")
+	AssertThat(t, ok, Is{true})
+
+	expireHistory(serial(), config.Retention{MaxAge: 24 * time.Hour}, history, now)
+	_, ok, _ = history.GetLaunch("expired-launch")
+	AssertThat(t, ok, Is{false})
+	tcs, _ := history.FindTestCases(store.Query{Id: "expired-test-case"})
+	AssertThat(t, len(tcs), EqualTo{0})
+}
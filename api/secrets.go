@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+)
+
+// Checks that secret references can be resolved returning all found problems
+func validateSecrets(conf *config.Config, properties []Property) []string {
+	var problems []string
+	for i, p := range properties {
+		if p.SecretRef == "" {
+			continue
+		}
+		if p.Value != "" {
+			problems = append(problems, fmt.Sprintf("properties[%d].secretRef: set together with value", i))
+		} else if _, ok := conf.Secret(p.SecretRef); !ok {
+			problems = append(problems, fmt.Sprintf("properties[%d].secretRef: unknown secret: %q", i, p.SecretRef))
+		}
+	}
+	return problems
+}
+
+// Returns a copy of properties with secret references replaced by their values
+func resolveSecrets(conf *config.Config, properties []Property) ([]Property, error) {
+	var ret []Property
+	for i, p := range properties {
+		if p.SecretRef != "" {
+			value, ok := conf.Secret(p.SecretRef)
+			if !ok {
+				return nil, fmt.Errorf("properties[%d].secretRef: unknown secret: %q", i, p.SecretRef)
+			}
+			p.Value = value
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+// Splits properties to ones that can be shown and secret ones
+func splitProperties(properties []Property) ([]Property, []Property) {
+	var public, secret []Property
+	for _, p := range properties {
+		if p.IsSecret() {
+			secret = append(secret, p)
+		} else {
+			public = append(public, p)
+		}
+	}
+	return public, secret
+}
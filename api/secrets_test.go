@@ -0,0 +1,76 @@
+package api
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/event"
+)
+
+func secretsConfig(t *testing.T) *config.Config {
+	os.Setenv("RT_TEST_DB_PASSWORD", "s3cr3t")
+	defer os.Unsetenv("RT_TEST_DB_PASSWORD")
+	conf := config.NewConfig(dataDir, 2*time.Hour, 5*time.Minute)
+	AssertThat(t, conf.LoadSecrets("../config/test-secrets.yml"), Is{nil})
+	return conf
+}
+
+func TestValidateSecrets(t *testing.T) {
+	conf := secretsConfig(t)
+	AssertThat(t, validateSecrets(conf, []Property{
+		{Key: "key1", Value: "value1"},
+		{Key: "password", Value: "s3cr3t", Secret: true},
+		{Key: "token", SecretRef: "api-token"},
+	}), EqualTo{[]string(nil)})
+	problems := validateSecrets(conf, []Property{
+		{Key: "token", Value: "t0ken", SecretRef: "api-token"},
+		{Key: "password", SecretRef: "missing"},
+	})
+	AssertThat(t, problems, EqualTo{[]string{"properties[0].secretRef: set together with value", `properties[1].secretRef: unknown secret: "missing"`}})
+}
+
+func TestResolveSecrets(t *testing.T) {
+	conf := secretsConfig(t)
+	properties := []Property{{Key: "key1", Value: "value1"}, {Key: "token", SecretRef: "api-token"}}
+	resolved, err := resolveSecrets(conf, properties)
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, resolved[1].Value, EqualTo{"t0ken"})
+	AssertThat(t, properties[1].Value, EqualTo{""})
+	AssertThat(t, MaskProperties(resolved)[1].Value, EqualTo{Masked})
+	AssertThat(t, resolved[1].String(), EqualTo{"token=****"})
+
+	_, err = resolveSecrets(conf, []Property{{Key: "password", SecretRef: "missing"}})
+	AssertThat(t, err, Is{Not{nil}})
+}
+
+func TestLaunchFinishedWhenSecretIsMissing(t *testing.T) {
+	conf := secretsConfig(t)
+	AssertThat(t, conf.Load("../config/test-config.json", "../config/test-log-config.json"), Is{nil})
+	launch := &Launch{
+		Id:         "launch-with-missing-secret",
+		Type:       "maven",
+		TestCases:  []TestCase{{Id: "missing-secret-test-case", Name: "Test#one"}},
+		Properties: []Property{{Key: "password", SecretRef: "missing"}},
+	}
+	evts, unsubscribe := eventBus.Subscribe()
+	defer unsubscribe()
+	launchImpl(serial(), conf, nil, history, nil, launch, nil)
+
+	var types []string
+	for len(evts) > 0 {
+		evt := <-evts
+		if evt.Id == launch.Id {
+			types = append(types, evt.Type)
+		}
+	}
+	AssertThat(t, types, EqualTo{[]string{event.LaunchStarted, event.LaunchFinished}})
+	record, ok, err := history.GetLaunch(launch.Id)
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, ok, Is{true})
+	AssertThat(t, record.Finished.IsZero(), Is{false})
+	AssertThat(t, record.TestCases, EqualTo{[]string{"missing-secret-test-case"}})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/logging"
+	"sync"
+	"time"
+)
+
+// Launches started or reattached and not finished yet including uploading results
+var activeLaunches sync.WaitGroup
+
+// Orders counting launches as active against Drain starting to wait for them
+var activeLaunchesLock sync.Mutex
+
+var (
+	drainPollInterval = 100 * time.Millisecond
+	terminateGrace    = time.Minute // Time terminated test cases get to be removed and uploaded
+)
+
+// Drain waits for running launches to finish. Test cases still running after
+// shutdown timeout are terminated. New launches should be refused before calling it.
+func Drain(conf *config.Config) {
+	// Launches counted before exit was closed are waited for, later ones are refused
+	activeLaunchesLock.Lock()
+	activeLaunchesLock.Unlock()
+	done := make(chan struct{})
+	go func() {
+		activeLaunches.Wait()
+		close(done)
+	}()
+	logging.With("shutdown_timeout", conf.ShutdownTimeout.String()).With("running", testCases.Len()).Info("DRAINING")
+	deadline := time.After(conf.ShutdownTimeout)
+	var giveUp <-chan time.Time
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			logging.Info("DRAINED")
+			return
+		case <-deadline:
+			deadline = nil
+			giveUp = time.After(terminateGrace)
+			logging.With("running", testCases.Len()).Warn("TERMINATING_TEST_CASES")
+			terminateAll()
+		case <-ticker.C:
+			if giveUp != nil {
+				terminateAll()
+			}
+		case <-giveUp:
+			logging.With("running", testCases.Len()).Error("FAILED_TO_DRAIN")
+			return
+		}
+	}
+}
+
+// Counts launch as active unless shutting down, should be done before launch is queued
+func acquireLaunch(exit chan bool) bool {
+	activeLaunchesLock.Lock()
+	defer activeLaunchesLock.Unlock()
+	if checkNotShuttingDown(exit) != nil {
+		return false
+	}
+	activeLaunches.Add(1)
+	return true
+}
+
+// Test cases started after shutdown timeout are terminated as soon as they appear
+func terminateAll() {
+	testCases.ForEach(func(tc *RunningTestCase) {
+		if !tc.isStopping() {
+			go tc.Terminate()
+		}
+	})
+}
+
+// FlushWebhooks waits for queued webhook deliveries no longer than timeout
+func FlushWebhooks(timeout time.Duration) {
+	if !webhooks.Wait(timeout) {
+		logging.With("timeout", timeout.String()).Warn("WEBHOOKS_NOT_DELIVERED")
+	}
+}
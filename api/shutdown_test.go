@@ -0,0 +1,146 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/store"
+	"github.com/gorilla/websocket"
+)
+
+func drainAsync(conf *config.Config) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		Drain(conf)
+		close(done)
+	}()
+	return done
+}
+
+func TestDrainWaitsForLaunches(t *testing.T) {
+	conf := config.NewConfig(dataDir, 2*time.Hour, time.Hour)
+	activeLaunches.Add(1)
+	done := drainAsync(conf)
+
+	select {
+	case <-done:
+		t.Fatal("drained while launch is running")
+	case <-time.After(200 * time.Millisecond):
+	}
+	activeLaunches.Done()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("not drained after launch finished")
+	}
+}
+
+func TestDrainTerminatesTestCases(t *testing.T) {
+	conf := config.NewConfig(dataDir, 2*time.Hour, 10*time.Millisecond)
+	var cancelled int32
+	rtc := &RunningTestCase{
+		LaunchId:   "drained-launch",
+		Cancel:     func() { atomic.AddInt32(&cancelled, 1) },
+		Terminated: make(chan struct{}),
+	}
+	testCases.Put("drained-test-case", rtc)
+	activeLaunches.Add(1)
+	go func() {
+		<-rtc.Terminated
+		testCases.Delete("drained-test-case")
+		activeLaunches.Done()
+	}()
+
+	select {
+	case <-drainAsync(conf):
+	case <-time.After(5 * time.Second):
+		t.Fatal("test case was not terminated")
+	}
+	rtc.Terminate()
+	AssertThat(t, atomic.LoadInt32(&cancelled), EqualTo{int32(1)})
+}
+
+func TestDrainGivesUp(t *testing.T) {
+	defer func(grace time.Duration) { terminateGrace = grace }(terminateGrace)
+	terminateGrace = 200 * time.Millisecond
+	conf := config.NewConfig(dataDir, 2*time.Hour, 10*time.Millisecond)
+	rtc := &RunningTestCase{LaunchId: "stuck-launch", Cancel: func() {}, Terminated: make(chan struct{})}
+	testCases.Put("stuck-test-case", rtc)
+	defer testCases.Delete("stuck-test-case")
+	activeLaunches.Add(1)
+	defer activeLaunches.Done()
+
+	select {
+	case <-drainAsync(conf):
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain did not give up")
+	}
+	AssertThat(t, rtc.isStopping(), Is{true})
+
+	// Stuck launch finishing after history is closed on exit
+	h, err := store.Open(path.Join(dataDir, "give-up.db"))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, h.Close(), Is{nil})
+	AssertThat(t, h.PutLaunch(&store.LaunchRecord{Id: "stuck-launch", Finished: time.Now()}), Is{nil})
+	AssertThat(t, h.UpdateTestCase(&store.TestCaseRecord{Id: "stuck-test-case", LaunchId: "stuck-launch", Outcome: store.Revoked}), Is{nil})
+}
+
+func TestLaunchRefusedOnShutdown(t *testing.T) {
+	conf := config.NewConfig(dataDir, 2*time.Hour, 5*time.Minute)
+	exit := make(chan bool)
+	close(exit)
+	w := httptest.NewRecorder()
+	launch(conf, nil, exit)(w, httptest.NewRequest(http.MethodPost, launchPath, strings.NewReader("{}")))
+
+	AssertThat(t, w.Code, EqualTo{http.StatusServiceUnavailable})
+	AssertThat(t, strings.Contains(w.Body.String(), "shutting down"), Is{true})
+}
+
+func TestLaunchQueuedConcurrentlyWithDrain(t *testing.T) {
+	conf := config.NewConfig(dataDir, 2*time.Hour, 5*time.Minute)
+	AssertThat(t, conf.Load("../config/test-config.json", "../config/test-log-config.json"), Is{nil})
+	exit := make(chan bool)
+	handler := launch(conf, nil, exit)
+	codes := make(chan int)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			body := fmt.Sprintf(`{"id":"draining-launch-%d","type":"maven","testcases":[{"id":"draining-test-case-%d","name":"Test#one"}]}`, i, i)
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodPost, launchPath, strings.NewReader(body)))
+			codes <- w.Code
+		}(i)
+	}
+
+	close(exit)
+	select {
+	case <-drainAsync(conf):
+	case <-time.After(5 * time.Second):
+		t.Fatal("not drained while launches were being queued")
+	}
+	for i := 0; i < 10; i++ {
+		AssertThat(t, <-codes, EqualTo{http.StatusServiceUnavailable})
+	}
+}
+
+func TestEventsClosedOnDrain(t *testing.T) {
+	drained := make(chan bool)
+	s := httptest.NewServer(http.HandlerFunc(events(history, drained)))
+	defer s.Close()
+	c, _, err := websocket.DefaultDialer.Dial(strings.Replace(s.URL, "http", "ws", 1), nil)
+	AssertThat(t, err, Is{nil})
+	defer c.Close()
+
+	close(drained)
+	_, _, err = c.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	AssertThat(t, ok, Is{true})
+	AssertThat(t, closeErr.Code, EqualTo{websocket.CloseGoingAway})
+}
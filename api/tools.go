@@ -3,8 +3,9 @@ package api
 import (
 	. "github.com/aerokube/rt/common"
 	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/logging"
 	"github.com/aerokube/rt/service"
-	"github.com/emicklei/go-restful/log"
+	"sort"
 )
 
 const (
@@ -23,29 +24,50 @@ type Tool interface {
 	GetCommand(container *config.Container, testCase TestCase, properties []Property) Command
 }
 
-// Converts launch object to a set of build settings for each separate container
+// Converts launch object to a set of build settings for each separate container.
+// Secret properties are expected to be resolved and are never put to command or build data.
 func GetParallelBuilds(container *config.Container, launch *Launch) map[string]service.BuildSettings {
 	ret := make(map[string]service.BuildSettings)
 	tool, ok := supportedTools[launch.Type]
 	if ok {
+		properties, secrets := splitProperties(launch.Properties)
+		secretsFile := ""
+		if len(secrets) > 0 {
+			secretsFile = service.SecretsMountPath
+		}
 		for _, testCase := range launch.TestCases {
 			bs := service.BuildSettings{
+				LaunchId:  launch.Id,
 				Image:     container.Image,
-				Command:   tool.GetCommand(container, testCase, launch.Properties),
+				Command:   tool.GetCommand(container, testCase, properties),
 				Tmpfs:     container.Tmpfs,
 				DataDir:   container.DataDir,
 				Templates: container.Templates,
 				Volumes:   container.Volumes,
+				Env:       container.Env,
+				Limits:    container.Limits,
 				BuildData: StandaloneTestCase{
-					TestCase:   testCase,
-					Properties: launch.Properties,
+					TestCase:    testCase,
+					Properties:  properties,
+					SecretsFile: secretsFile,
 				},
+				Secrets: secrets,
 			}
 			ret[testCase.Id] = bs
 		}
 	} else {
-		log.Printf("Trying to use unsupported tool: %s. This is probably a bug.\n", launch.Type)
+		logging.Launch(launch.Id).With("type", launch.Type).Error("UNSUPPORTED_TOOL")
+	}
+	return ret
+}
+
+// Returns sorted names of supported tools
+func SupportedTools() []string {
+	var ret []string
+	for name := range supportedTools {
+		ret = append(ret, name)
 	}
+	sort.Strings(ret)
 	return ret
 }
 
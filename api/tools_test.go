@@ -68,6 +68,7 @@ func TestGetParallelBuilds(t *testing.T) {
 	parallelBuilds := GetParallelBuilds(&testContainer, &testLaunch)
 	correctBuilds := map[string] service.BuildSettings{
 		"test-case-1": {
+			LaunchId: "test-launch-id",
 			Image: "test-image",
 			Command: testCommand,
 			Tmpfs: map[string] string{},
@@ -80,6 +81,7 @@ func TestGetParallelBuilds(t *testing.T) {
 			},
 		},
 		"test-case-2": {
+			LaunchId: "test-launch-id",
 			Image: "test-image",
 			Command: testCommand,
 			Tmpfs: map[string] string{},
@@ -93,4 +95,18 @@ func TestGetParallelBuilds(t *testing.T) {
 		},
 	}
 	AssertThat(t, parallelBuilds, EqualTo{correctBuilds})
-}
\ No newline at end of file
+}
+
+func TestGetParallelBuildsWithSecrets(t *testing.T) {
+	launch := testLaunch
+	launch.TestCases = []TestCase{testCase1}
+	launch.Properties = []Property{
+		{Key: "key1", Value: "value1"},
+		{Key: "password", Value: "s3cr3t", Secret: true},
+		{Key: "token", Value: "resolved", SecretRef: "api-token"},
+	}
+	bs := GetParallelBuilds(&testContainer, &launch)["test-case-1"]
+	AssertThat(t, bs.BuildData.Properties, EqualTo{[]Property{{Key: "key1", Value: "value1"}}})
+	AssertThat(t, bs.BuildData.SecretsFile, EqualTo{service.SecretsMountPath})
+	AssertThat(t, bs.Secrets, EqualTo{launch.Properties[1:]})
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/s3"
+	"github.com/aerokube/rt/store"
+	"os"
+	"path"
+	"time"
+)
+
+// Copies test case results to object storage and saves their URLs to history
+func uploadArtifacts(requestId RequestId, uploader *s3.Client, history *store.Store, record *store.TestCaseRecord) {
+	if uploader == nil || record.ArtifactPath == "" {
+		return
+	}
+	if _, err := os.Stat(record.ArtifactPath); os.IsNotExist(err) {
+		return
+	}
+	start := time.Now()
+	logging.Request(requestId).Launch(record.LaunchId).TestCase(record.Id).Info("UPLOADING_ARTIFACTS")
+	urls, err := uploader.UploadDir(record.ArtifactPath, path.Join(record.LaunchId, record.Id))
+	if err != nil {
+		logging.Request(requestId).Launch(record.LaunchId).TestCase(record.Id).Err(err).Error("FAILED_TO_UPLOAD_ARTIFACTS")
+		return
+	}
+	record.ArtifactUrls = urls
+	err = history.UpdateTestCase(record)
+	if err != nil {
+		logging.Request(requestId).Launch(record.LaunchId).TestCase(record.Id).Err(err).Error("FAILED_TO_SAVE_HISTORY")
+	}
+	logging.Request(requestId).Launch(record.LaunchId).TestCase(record.Id).With("files", len(urls)).Duration(time.Since(start)).Info("ARTIFACTS_UPLOADED")
+	if uploader.Config.DeleteLocal {
+		err := os.RemoveAll(record.ArtifactPath)
+		if err != nil {
+			logging.Request(requestId).Launch(record.LaunchId).TestCase(record.Id).Err(err).Error("FAILED_TO_REMOVE_ARTIFACTS")
+		}
+	}
+}
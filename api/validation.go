@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/webhook"
+	"io"
+	"net/http"
+	"regexp"
+)
+
+// IDs are used as directory names and container labels
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+const maxIdLength = 128
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// Fails reading when body is longer than n bytes
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+// Zero or negative n means no limit
+func limitBody(r io.Reader, n int64) io.Reader {
+	if n <= 0 {
+		return r
+	}
+	return &limitedReader{r, n}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+// Error response body
+type apiError struct {
+	Error    string   `json:"error"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string, problems ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Error: message, Problems: problems})
+}
+
+// Checks launch against configuration and limits returning all found problems
+func validateLaunch(conf *config.Config, launch *Launch) []string {
+	limits := conf.LaunchLimits
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	checkLength := func(field string, value string) {
+		check(limits.MaxValueLength <= 0 || len([]rune(value)) <= limits.MaxValueLength, "%s: longer than %d characters", field, limits.MaxValueLength)
+	}
+	checkId := func(field string, id string) {
+		check(id != "", "%s: empty", field)
+		check(id == "" || (len(id) <= maxIdLength && idPattern.MatchString(id)), "%s: should be at most %d letters, digits, dots, dashes or underscores: %q", field, maxIdLength, id)
+	}
+
+	checkId("id", launch.Id)
+	if !IsToolSupported(launch.Type) {
+		problems = append(problems, fmt.Sprintf("type: unsupported: %q", launch.Type))
+	} else if _, _, ok := conf.FindContainer(launch.Type, launch.Container); !ok {
+		problems = append(problems, fmt.Sprintf("container: unsupported for %s: %q", launch.Type, launch.Container))
+	}
+	check(len(launch.TestCases) > 0, "testcases: empty")
+	check(limits.MaxTestCases <= 0 || len(launch.TestCases) <= limits.MaxTestCases, "testcases: more than %d", limits.MaxTestCases)
+	ids := make(map[string]bool)
+	for i, tc := range launch.TestCases {
+		field := fmt.Sprintf("testcases[%d]", i)
+		checkId(field+".id", tc.Id)
+		check(tc.Id == "" || !ids[tc.Id], "%s.id: duplicate: %s", field, tc.Id)
+		ids[tc.Id] = true
+		check(tc.Name != "", "%s.name: empty", field)
+		checkLength(field+".name", tc.Name)
+		checkLength(field+".artifact.groupId", tc.Artifact.GroupId)
+		checkLength(field+".artifact.id", tc.Artifact.Id)
+		checkLength(field+".artifact.version", tc.Artifact.Version)
+		for j, tag := range tc.Tags {
+			checkLength(fmt.Sprintf("%s.tags[%d]", field, j), tag)
+		}
+	}
+	keys := make(map[string]bool)
+	for i, p := range launch.Properties {
+		field := fmt.Sprintf("properties[%d]", i)
+		check(p.Key != "", "%s.key: empty", field)
+		check(p.Key == "" || !keys[p.Key], "%s.key: duplicate: %s", field, p.Key)
+		keys[p.Key] = true
+		checkLength(field+".key", p.Key)
+		checkLength(field+".value", p.Value)
+	}
+	problems = append(problems, validateSecrets(conf, launch.Properties)...)
+	if err, ok := webhook.Validate(launch.Webhooks).(ValidationError); ok {
+		problems = append(problems, err...)
+	}
+	check(len(launch.Webhooks) == 0 || len(conf.WebhookUrls) > 0, "webhooks: launch webhooks are disabled")
+	for i, hook := range launch.Webhooks {
+		check(len(conf.WebhookUrls) == 0 || webhook.Allowed(hook.Url, conf.WebhookUrls), "webhooks[%d].url: not allowed: %q", i, hook.Url)
+	}
+	return problems
+}
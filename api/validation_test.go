@@ -0,0 +1,74 @@
+package api
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+)
+
+func TestValidateLaunch(t *testing.T) {
+	conf := config.NewConfig(dataDir, 2*time.Hour, 5*time.Minute)
+	AssertThat(t, conf.Load("../config/test-config.json", "../config/test-log-config.json"), Is{nil})
+	conf.LaunchLimits = config.LaunchLimits{MaxTestCases: 3, MaxValueLength: 10}
+	valid := &Launch{
+		Id:         "launch-1",
+		Type:       "maven",
+		TestCases:  []TestCase{{Id: "tc-1", Name: "Test#one"}, {Id: "tc-2", Name: "Test#two"}},
+		Properties: []Property{{Key: "key1", Value: "value1"}},
+	}
+	AssertThat(t, validateLaunch(conf, valid), EqualTo{[]string(nil)})
+
+	invalid := &Launch{
+		Id:   "../etc",
+		Type: "maven",
+		TestCases: []TestCase{
+			{Id: "tc-1", Name: "Test#one"},
+			{Id: "tc-1", Name: ""},
+			{Id: "tc-3", Name: "Test#three", Tags: []string{"very long tag"}},
+			{Id: "tc-4", Name: "Test#four"},
+		},
+		Properties: []Property{{Key: "key1", Value: "value1"}, {Key: "key1", Value: "value2"}, {Value: "value3"}},
+	}
+	AssertThat(t, validateLaunch(conf, invalid), EqualTo{[]string{
+		`id: should be at most 128 letters, digits, dots, dashes or underscores: "../etc"`,
+		"testcases: more than 3",
+		"testcases[1].id: duplicate: tc-1",
+		"testcases[1].name: empty",
+		"testcases[2].tags[0]: longer than 10 characters",
+		"properties[1].key: duplicate: key1",
+		"properties[2].key: empty",
+	}})
+
+	AssertThat(t, validateLaunch(conf, &Launch{Id: "launch-2", Type: "npm"}), EqualTo{[]string{
+		`type: unsupported: "npm"`,
+		"testcases: empty",
+	}})
+
+	hooks := &Launch{
+		Id:        "launch-3",
+		Type:      "maven",
+		TestCases: []TestCase{{Id: "tc-1", Name: "Test#one"}},
+		Webhooks:  []Webhook{{Url: "https://bot.example.com/rt"}, {Url: "http://169.254.169.254/latest"}},
+	}
+	AssertThat(t, validateLaunch(conf, hooks), EqualTo{[]string{"webhooks: launch webhooks are disabled"}})
+	conf.WebhookUrls = []string{"https://bot.example.com/"}
+	AssertThat(t, validateLaunch(conf, hooks), EqualTo{[]string{`webhooks[1].url: not allowed: "http://169.254.169.254/latest"`}})
+}
+
+func TestLimitBody(t *testing.T) {
+	data, err := ioutil.ReadAll(limitBody(strings.NewReader("0123456789"), 10))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, string(data), EqualTo{"0123456789"})
+
+	_, err = ioutil.ReadAll(limitBody(strings.NewReader("0123456789"), 9))
+	AssertThat(t, err, EqualTo{errBodyTooLarge})
+
+	data, err = ioutil.ReadAll(limitBody(strings.NewReader("0123456789"), 0))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, len(data), EqualTo{10})
+}
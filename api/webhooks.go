@@ -0,0 +1,22 @@
+package api
+
+import (
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/webhook"
+)
+
+var webhooks = webhook.NewDispatcher()
+
+func init() {
+	eventBus.AddListener(webhooks.Dispatch)
+}
+
+// ConfigureWebhooks enables global webhooks from configuration and sets where failed deliveries are saved
+func ConfigureWebhooks(conf *config.Config, deadLetterPath string, attempts int) {
+	webhooks.Global = func() []Webhook {
+		return conf.Webhooks()
+	}
+	webhooks.DeadLetterPath = deadLetterPath
+	webhooks.Attempts = attempts
+}
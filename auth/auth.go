@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"github.com/aerokube/rt/common"
+	"strings"
+)
+
+// Token scopes
+const (
+	LaunchScope     = "launch"
+	TerminateScope  = "terminate"
+	ReadEventsScope = "read-events" // Events, logs, artifacts and history
+	AdminScope      = "admin"       // Everything including launches of other tokens
+)
+
+var scopes = []string{LaunchScope, TerminateScope, ReadEventsScope, AdminScope}
+
+const hashPrefix = "sha256:"
+
+// API client token, only its hash is stored in configuration
+type Token struct {
+	Name   string   `json:"name" yaml:"name"` // Owner of launches created with this token
+	Hash   string   `json:"hash" yaml:"hash"` // sha256:<hex>
+	Scopes []string `json:"scopes" yaml:"scopes"`
+}
+
+// Hash returns value to put to configuration for secret token
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// Find returns token matching secret from Authorization header
+func Find(tokens []Token, secret string) (*Token, bool) {
+	hash := []byte(Hash(secret))
+	for i := range tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(strings.ToLower(tokens[i].Hash))) == 1 {
+			return &tokens[i], true
+		}
+	}
+	return nil, false
+}
+
+// Allows tells whether token has scope, nil token means authentication is disabled
+func (t *Token) Allows(scope string) bool {
+	if t == nil {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if s == scope || s == AdminScope {
+			return true
+		}
+	}
+	return false
+}
+
+// Owns tells whether token can view and terminate launch created by owner
+func (t *Token) Owns(owner string) bool {
+	return t == nil || t.Name == owner || t.Allows(AdminScope)
+}
+
+// Owner is saved with launches created with token
+func (t *Token) Owner() string {
+	if t == nil {
+		return ""
+	}
+	return t.Name
+}
+
+// Validate checks names, hashes and scopes returning common.ValidationError listing all found problems
+func Validate(tokens []Token) error {
+	var problems common.ValidationError
+	names := make(map[string]bool)
+	for i, t := range tokens {
+		field := fmt.Sprintf("tokens[%d]", i)
+		if t.Name == "" {
+			problems = append(problems, field+".name: empty")
+		} else if names[t.Name] {
+			problems = append(problems, fmt.Sprintf("%s.name: duplicate: %s", field, t.Name))
+		}
+		names[t.Name] = true
+		hash := strings.TrimPrefix(strings.ToLower(t.Hash), hashPrefix)
+		if b, err := hex.DecodeString(hash); !strings.HasPrefix(strings.ToLower(t.Hash), hashPrefix) || err != nil || len(b) != sha256.Size {
+			problems = append(problems, fmt.Sprintf("%s.hash: should be %s followed by hex SHA-256", field, hashPrefix))
+		}
+		if len(t.Scopes) == 0 {
+			problems = append(problems, field+".scopes: empty")
+		}
+		for j, s := range t.Scopes {
+			if !isKnownScope(s) {
+				problems = append(problems, fmt.Sprintf("%s.scopes[%d]: unknown scope: %s", field, j, s))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func isKnownScope(scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/aandryashin/matchers"
+	"github.com/aerokube/rt/common"
+)
+
+var tokens = []Token{
+	{Name: "team-a", Hash: Hash("secret-a"), Scopes: []string{LaunchScope, ReadEventsScope}},
+	{Name: "ops", Hash: strings.ToUpper(Hash("secret-ops")), Scopes: []string{AdminScope}},
+}
+
+func TestHash(t *testing.T) {
+	AssertThat(t, Hash("abc"), EqualTo{"sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"})
+}
+
+func TestFind(t *testing.T) {
+	token, ok := Find(tokens, "secret-a")
+	AssertThat(t, ok, Is{true})
+	AssertThat(t, token.Name, EqualTo{"team-a"})
+	token, ok = Find(tokens, "secret-ops")
+	AssertThat(t, ok, Is{true})
+	AssertThat(t, token.Name, EqualTo{"ops"})
+	_, ok = Find(tokens, "secret-b")
+	AssertThat(t, ok, Is{false})
+}
+
+func TestScopesAndOwnership(t *testing.T) {
+	team, admin := &tokens[0], &tokens[1]
+	AssertThat(t, team.Allows(LaunchScope), Is{true})
+	AssertThat(t, team.Allows(TerminateScope), Is{false})
+	AssertThat(t, admin.Allows(TerminateScope), Is{true})
+	AssertThat(t, team.Owns("team-a"), Is{true})
+	AssertThat(t, team.Owns("team-b"), Is{false})
+	AssertThat(t, admin.Owns("team-b"), Is{true})
+
+	var disabled *Token
+	AssertThat(t, disabled.Allows(AdminScope), Is{true})
+	AssertThat(t, disabled.Owns("team-b"), Is{true})
+	AssertThat(t, disabled.Owner(), EqualTo{""})
+}
+
+func TestValidate(t *testing.T) {
+	AssertThat(t, Validate(tokens), Is{nil})
+	err := Validate([]Token{
+		{Name: "", Hash: "md5:abc", Scopes: []string{"everything"}},
+		{Name: "a", Hash: Hash("a")},
+		{Name: "a", Hash: Hash("b"), Scopes: []string{LaunchScope}},
+	})
+	AssertThat(t, err, EqualTo{common.ValidationError{
+		"tokens[0].name: empty",
+		"tokens[0].hash: should be sha256: followed by hex SHA-256",
+		"tokens[0].scopes[0]: unknown scope: everything",
+		"tokens[1].scopes: empty",
+		"tokens[2].name: duplicate: a",
+	}})
+}
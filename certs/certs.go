@@ -0,0 +1,106 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// Loader keeps server certificate and client CA bundle that can be
+// replaced without restarting listener
+type Loader struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string // Client certificates are verified when set and required by Handler
+
+	lock      sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewLoader checks that files are consistent and loads them
+func NewLoader(certFile string, keyFile string, clientCAFile string) (*Loader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both certificate and key files should be set")
+	}
+	l := &Loader{CertFile: certFile, KeyFile: keyFile, ClientCAFile: clientCAFile}
+	err := l.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload reads files again, previous certificates are kept on error
+func (l *Loader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(l.CertFile, l.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %v", err)
+	}
+	var clientCAs *x509.CertPool
+	if l.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(l.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("load client CA: %v", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("load client CA: no certificates found in %s", l.ClientCAFile)
+		}
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.cert, l.clientCAs = &cert, clientCAs
+	return nil
+}
+
+// Certificate returns currently used server certificate
+func (l *Loader) Certificate() *tls.Certificate {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.cert
+}
+
+// TLSConfig returns server configuration picking up reloaded files on every handshake
+func (l *Loader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			l.lock.RLock()
+			defer l.lock.RUnlock()
+			conf := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*l.cert},
+			}
+			// Handshake succeeds without certificate so that probes can reach open paths
+			if l.clientCAs != nil {
+				conf.ClientAuth = tls.VerifyClientCertIfGiven
+				conf.ClientCAs = l.clientCAs
+			}
+			return conf, nil
+		},
+	}
+}
+
+// Handler rejects requests without verified client certificate when client CA is set,
+// requests to open paths such as health checks are passed without one
+func (l *Loader) Handler(next http.Handler, open ...string) http.Handler {
+	if l.ClientCAFile == "" {
+		return next
+	}
+	openPaths := make(map[string]bool)
+	for _, path := range open {
+		openPaths[path] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !openPaths[r.URL.Path] && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			http.Error(w, "Client certificate required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,157 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+)
+
+type keyPair struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newKeyPair(t *testing.T, name string, parent *keyPair) *keyPair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	AssertThat(t, err, Is{nil})
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	AssertThat(t, err, Is{nil})
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &keyPair{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeFile(t *testing.T, dir string, name string, data []byte) string {
+	p := filepath.Join(dir, name)
+	AssertThat(t, ioutil.WriteFile(p, data, 0600), Is{nil})
+	return p
+}
+
+func TestNewLoaderRequiresKeyPair(t *testing.T) {
+	_, err := NewLoader("cert.pem", "", "")
+	AssertThat(t, err, Is{Not{nil}})
+	_, err = NewLoader("missing-cert.pem", "missing-key.pem", "")
+	AssertThat(t, err, Is{Not{nil}})
+}
+
+func TestReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "rt-certs")
+	defer os.RemoveAll(dir)
+	ca := newKeyPair(t, "ca", nil)
+	first := newKeyPair(t, "first", ca)
+	certFile := writeFile(t, dir, "cert.pem", first.certPEM)
+	keyFile := writeFile(t, dir, "key.pem", first.keyPEM)
+	loader, err := NewLoader(certFile, keyFile, "")
+	AssertThat(t, err, Is{nil})
+
+	second := newKeyPair(t, "second", ca)
+	writeFile(t, dir, "cert.pem", second.certPEM)
+	writeFile(t, dir, "key.pem", second.keyPEM)
+	AssertThat(t, loader.Reload(), Is{nil})
+	leaf, _ := x509.ParseCertificate(loader.Certificate().Certificate[0])
+	AssertThat(t, leaf.Subject.CommonName, EqualTo{"second"})
+
+	writeFile(t, dir, "key.pem", first.keyPEM)
+	AssertThat(t, loader.Reload(), Is{Not{nil}})
+	leaf, _ = x509.ParseCertificate(loader.Certificate().Certificate[0])
+	AssertThat(t, leaf.Subject.CommonName, EqualTo{"second"})
+}
+
+func TestClientCertificateRequired(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "rt-certs")
+	defer os.RemoveAll(dir)
+	ca := newKeyPair(t, "ca", nil)
+	server := newKeyPair(t, "server", ca)
+	client := newKeyPair(t, "client", ca)
+	loader, err := NewLoader(
+		writeFile(t, dir, "cert.pem", server.certPEM),
+		writeFile(t, dir, "key.pem", server.keyPEM),
+		writeFile(t, dir, "ca.pem", ca.certPEM),
+	)
+	AssertThat(t, err, Is{nil})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			w.Write([]byte("anonymous"))
+			return
+		}
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	})
+	srv := httptest.NewUnstartedServer(loader.Handler(handler, "/health/live"))
+	srv.TLS = loader.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+	get := func(c *http.Client, path string) (int, string) {
+		rsp, err := c.Get(srv.URL + path)
+		AssertThat(t, err, Is{nil})
+		defer rsp.Body.Close()
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return rsp.StatusCode, string(body)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	code, _ := get(anonymous, "/launch")
+	AssertThat(t, code, EqualTo{http.StatusForbidden})
+	code, body := get(anonymous, "/health/live")
+	AssertThat(t, code, EqualTo{http.StatusOK})
+	AssertThat(t, body, EqualTo{"anonymous"})
+
+	clientCert, _ := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	authenticated := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert},
+	}}}
+	code, body = get(authenticated, "/launch")
+	AssertThat(t, code, EqualTo{http.StatusOK})
+	AssertThat(t, body, EqualTo{"client"})
+
+	untrusted := newKeyPair(t, "untrusted", newKeyPair(t, "other-ca", nil))
+	untrustedCert, _ := tls.X509KeyPair(untrusted.certPEM, untrusted.keyPEM)
+	forged := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{untrustedCert},
+	}}}
+	code, _ = get(forged, "/launch")
+	AssertThat(t, code, EqualTo{http.StatusForbidden})
+}
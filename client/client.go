@@ -0,0 +1,220 @@
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/event"
+	"github.com/aerokube/rt/store"
+	"github.com/gorilla/websocket"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client calls rt API
+type Client struct {
+	Url        string       // E.g. http://localhost:8080
+	Token      string       // Sent as bearer token when set
+	TLSConfig  *tls.Config  // Used for both HTTPS requests and event stream
+	HTTPClient *http.Client // Created from TLSConfig on first request when not set
+
+	initHTTPClient sync.Once
+}
+
+// New creates client for rt at url
+func New(url string, token string) *Client {
+	return &Client{Url: strings.TrimSuffix(url, "/"), Token: token}
+}
+
+// Error returned for unsuccessful responses
+type Error struct {
+	StatusCode int
+	Message    string
+	Problems   []string
+	RetryAfter time.Duration // Set for 429 Too Many Requests
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if len(e.Problems) > 0 {
+		msg += ": " + strings.Join(e.Problems, "; ")
+	}
+	return msg
+}
+
+// Launch with its test case results
+type LaunchResult struct {
+	store.LaunchRecord
+	Results []store.TestCaseRecord `json:"results"`
+}
+
+// Launch submits launch, it is started in background
+func (c *Client) Launch(launch *Launch) error {
+	rsp, err := c.do(http.MethodPost, "/launch", launch)
+	if err != nil {
+		return err
+	}
+	return rsp.Body.Close()
+}
+
+// Validate returns container settings launch would be started with without starting it
+func (c *Client) Validate(launch *Launch) (json.RawMessage, error) {
+	rsp, err := c.do(http.MethodPost, "/launch/validate", launch)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	return ioutil.ReadAll(rsp.Body)
+}
+
+// Terminate stops running test cases
+func (c *Client) Terminate(testCaseIds ...string) error {
+	rsp, err := c.do(http.MethodPut, "/terminate", testCaseIds)
+	if err != nil {
+		return err
+	}
+	return rsp.Body.Close()
+}
+
+// History returns launch and results of all its test case attempts
+func (c *Client) History(launchId string) (*LaunchResult, error) {
+	rsp, err := c.do(http.MethodGet, "/history/launches/"+url.PathEscape(launchId), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	var ret LaunchResult
+	err = json.NewDecoder(rsp.Body).Decode(&ret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid launch history: %v", err)
+	}
+	return &ret, nil
+}
+
+// DownloadArtifacts writes archive with results of all launch test cases, archive is tar.gz or zip
+func (c *Client) DownloadArtifacts(launchId string, archive string, w io.Writer) error {
+	rsp, err := c.do(http.MethodGet, fmt.Sprintf("/launches/%s/artifacts?archive=%s", url.PathEscape(launchId), url.QueryEscape(archive)), nil)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	_, err = io.Copy(w, rsp.Body)
+	return err
+}
+
+// Events receives events fired after it was called
+type Events struct {
+	conn *websocket.Conn
+}
+
+// Events connects to event stream, launch events should be subscribed to before launching
+func (c *Client) Events() (*Events, error) {
+	u, err := url.Parse(c.Url + "/events")
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	dialer := &websocket.Dialer{TLSClientConfig: c.TLSConfig, HandshakeTimeout: 30 * time.Second}
+	conn, rsp, err := dialer.Dial(u.String(), c.header())
+	if err == websocket.ErrBadHandshake && rsp != nil {
+		defer rsp.Body.Close()
+		return nil, responseError(rsp)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect to events: %v", err)
+	}
+	return &Events{conn: conn}, nil
+}
+
+// Next blocks until event is received, stream can not be used after error
+func (e *Events) Next() (event.Event, error) {
+	var evt event.Event
+	_, data, err := e.conn.ReadMessage()
+	if err != nil {
+		return evt, err
+	}
+	err = json.Unmarshal(data, &evt)
+	if err != nil {
+		return evt, fmt.Errorf("invalid event: %v", err)
+	}
+	return evt, nil
+}
+
+func (e *Events) Close() error {
+	return e.conn.Close()
+}
+
+func (c *Client) header() http.Header {
+	h := http.Header{}
+	if c.Token != "" {
+		h.Set("Authorization", "Bearer "+c.Token)
+	}
+	return h
+}
+
+// Transport is shared by all requests so that connections are reused
+func (c *Client) httpClient() *http.Client {
+	c.initHTTPClient.Do(func() {
+		if c.HTTPClient == nil && c.TLSConfig != nil {
+			c.HTTPClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: c.TLSConfig}}
+		}
+	})
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Sends request returning response only when it is successful
+func (c *Client) do(method string, path string, body interface{}) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.Url+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = c.header()
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rsp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode/100 != 2 {
+		defer rsp.Body.Close()
+		return nil, responseError(rsp)
+	}
+	return rsp, nil
+}
+
+// Error responses are JSON for launch requests and plain text otherwise
+func responseError(rsp *http.Response) error {
+	var body struct {
+		Error    string   `json:"error"`
+		Problems []string `json:"problems"`
+	}
+	json.NewDecoder(io.LimitReader(rsp.Body, 1<<20)).Decode(&body)
+	e := &Error{StatusCode: rsp.StatusCode, Message: body.Error, Problems: body.Problems}
+	if seconds, err := strconv.Atoi(rsp.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return e
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/event"
+	"github.com/aerokube/rt/store"
+	"github.com/gorilla/websocket"
+)
+
+func testServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/launch", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "A bearer token is required"}`))
+			return
+		}
+		var launch Launch
+		json.NewDecoder(r.Body).Decode(&launch)
+		if launch.Id == "busy" {
+			w.Header().Set("Retry-After", "30")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error": "Too many requests"}`))
+			return
+		}
+		if launch.Type != "maven" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "Invalid launch", "problems": ["type: unsupported: \"gradle\""]}`))
+		}
+	})
+	mux.HandleFunc("/history/launches/launch-1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(LaunchResult{
+			LaunchRecord: store.LaunchRecord{Id: "launch-1", TestCases: []string{"tc-1"}},
+			Results:      []store.TestCaseRecord{{Id: "tc-1", LaunchId: "launch-1", Outcome: store.Passed}},
+		})
+	})
+	mux.HandleFunc("/launches/launch-1/artifacts", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("archive:" + r.URL.Query().Get("archive")))
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		data, _ := json.Marshal(event.Event{Type: event.TestCasePassed, Id: "tc-1", LaunchId: "launch-1"})
+		c.WriteMessage(websocket.TextMessage, data)
+		c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "bye"), time.Now().Add(time.Second))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestLaunch(t *testing.T) {
+	srv := testServer()
+	defer srv.Close()
+	c := New(srv.URL+"/", "secret")
+
+	AssertThat(t, c.Launch(&Launch{Id: "launch-1", Type: "maven"}), Is{nil})
+
+	err := c.Launch(&Launch{Id: "launch-1", Type: "gradle"})
+	apiErr, ok := err.(*Error)
+	AssertThat(t, ok, Is{true})
+	AssertThat(t, apiErr.StatusCode, EqualTo{http.StatusBadRequest})
+	AssertThat(t, apiErr.Message, EqualTo{"Invalid launch"})
+	AssertThat(t, apiErr.Problems, EqualTo{[]string{`type: unsupported: "gradle"`}})
+
+	apiErr = c.Launch(&Launch{Id: "busy", Type: "maven"}).(*Error)
+	AssertThat(t, apiErr.RetryAfter, EqualTo{30 * time.Second})
+}
+
+func TestUnauthorized(t *testing.T) {
+	srv := testServer()
+	defer srv.Close()
+
+	apiErr := New(srv.URL, "").Launch(&Launch{Id: "launch-1"}).(*Error)
+	AssertThat(t, apiErr.StatusCode, EqualTo{http.StatusUnauthorized})
+	AssertThat(t, apiErr.Message, EqualTo{"A bearer token is required"})
+}
+
+func TestErrorWithoutBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer srv.Close()
+
+	err := New(srv.URL, "").Launch(&Launch{Id: "launch-1"})
+	AssertThat(t, err.Error(), EqualTo{"405 Method Not Allowed"})
+}
+
+func TestHistory(t *testing.T) {
+	srv := testServer()
+	defer srv.Close()
+
+	result, err := New(srv.URL, "").History("launch-1")
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, result.Id, EqualTo{"launch-1"})
+	AssertThat(t, len(result.Results), EqualTo{1})
+	AssertThat(t, result.Results[0].Outcome, EqualTo{store.Passed})
+
+	_, err = New(srv.URL, "").History("missing")
+	AssertThat(t, err.(*Error).StatusCode, EqualTo{http.StatusNotFound})
+}
+
+func TestDownloadArtifacts(t *testing.T) {
+	srv := testServer()
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	AssertThat(t, New(srv.URL, "").DownloadArtifacts("launch-1", "zip", &buf), Is{nil})
+	AssertThat(t, buf.String(), EqualTo{"archive:zip"})
+}
+
+func TestEvents(t *testing.T) {
+	srv := testServer()
+	defer srv.Close()
+
+	events, err := New(srv.URL, "").Events()
+	AssertThat(t, err, Is{nil})
+	defer events.Close()
+	evt, err := events.Next()
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, evt, EqualTo{event.Event{Type: event.TestCasePassed, Id: "tc-1", LaunchId: "launch-1"}})
+	_, err = events.Next()
+	AssertThat(t, websocket.IsCloseError(err, websocket.CloseGoingAway), Is{true})
+}
+
+func TestEventsHandshakeError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"error": "Scope read-events is required"}`))
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, "").Events()
+	apiErr, ok := err.(*Error)
+	AssertThat(t, ok, Is{true})
+	AssertThat(t, apiErr.StatusCode, EqualTo{http.StatusForbidden})
+}
+
+func TestHTTPClientCreatedOnce(t *testing.T) {
+	c := New("https://localhost:8080", "")
+	AssertThat(t, c.httpClient(), EqualTo{http.DefaultClient})
+
+	c = New("https://localhost:8080", "")
+	c.TLSConfig = &tls.Config{}
+	first := c.httpClient()
+	AssertThat(t, first == http.DefaultClient, Is{false})
+	AssertThat(t, c.httpClient() == first, Is{true})
+	AssertThat(t, c.HTTPClient == first, Is{true})
+}
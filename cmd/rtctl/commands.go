@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aerokube/rt/client"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func terminateCommand(args []string) int {
+	fs := flag.NewFlagSet("terminate", flag.ExitOnError)
+	var conn connection
+	conn.register(fs)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fail("at least one test case ID is expected")
+	}
+	c, err := conn.client()
+	if err != nil {
+		return fail("%v", err)
+	}
+	err = c.Terminate(fs.Args()...)
+	if err != nil {
+		return fail("terminate: %v", err)
+	}
+	return exitPassed
+}
+
+func eventsCommand(args []string) int {
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	var conn connection
+	conn.register(fs)
+	launchId := fs.String("launch", "", "only print events of this launch")
+	fs.Parse(args)
+	c, err := conn.client()
+	if err != nil {
+		return fail("%v", err)
+	}
+	events, err := c.Events()
+	if err != nil {
+		return fail("%v", err)
+	}
+	defer events.Close()
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		evt, err := events.Next()
+		if err != nil {
+			return fail("events: %v", err)
+		}
+		if *launchId == "" || evt.Launch() == *launchId {
+			enc.Encode(evt)
+		}
+	}
+}
+
+func artifactsCommand(args []string) int {
+	fs := flag.NewFlagSet("artifacts", flag.ExitOnError)
+	var conn connection
+	conn.register(fs)
+	output := fs.String("o", "", "file to save archive to, <launch id>.tar.gz by default, .zip extension selects zip archive")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fail("launch ID is expected")
+	}
+	launchId := fs.Arg(0)
+	if *output == "" {
+		*output = launchId + ".tar.gz"
+	}
+	c, err := conn.client()
+	if err != nil {
+		return fail("%v", err)
+	}
+	err = download(c, launchId, *output)
+	if err != nil {
+		return fail("download artifacts: %v", err)
+	}
+	return exitPassed
+}
+
+// Archive format is chosen by file extension
+func archiveFormat(path string) string {
+	if strings.ToLower(filepath.Ext(path)) == ".zip" {
+		return "zip"
+	}
+	return "tar.gz"
+}
+
+func download(c *client.Client, launchId string, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = c.DownloadArtifacts(launchId, archiveFormat(path), f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Saved results of %s to %s\n", launchId, path)
+	return nil
+}
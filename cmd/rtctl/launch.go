@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aerokube/rt/client"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/event"
+	"github.com/aerokube/rt/store"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Launch fields that can be set with flags, they override launch file
+type launchFlags struct {
+	id         string
+	launchType string
+	container  string
+	artifact   string
+	tests      listFlag
+	tags       listFlag
+	properties listFlag
+	secrets    listFlag
+	secretRefs listFlag
+	webhooks   listFlag
+}
+
+func (lf *launchFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&lf.id, "id", "", "launch ID, generated when not set in launch file")
+	fs.StringVar(&lf.launchType, "type", "", "launch type, e.g. maven")
+	fs.StringVar(&lf.container, "container", "", "container variant, default one when empty")
+	fs.StringVar(&lf.artifact, "artifact", "", "groupId:artifactId:version of artifact with tests, used for test cases without artifact")
+	fs.Var(&lf.tests, "test", "test case name, can be repeated")
+	fs.Var(&lf.tags, "tag", "tag of test cases added with -test, can be repeated")
+	fs.Var(&lf.properties, "property", "key=value launch property, can be repeated")
+	fs.Var(&lf.secrets, "secret", "key=value secret launch property, can be repeated")
+	fs.Var(&lf.secretRefs, "secret-ref", "key=name property taking value from rt secrets file, can be repeated")
+	fs.Var(&lf.webhooks, "webhook", "URL to send launch events to, can be repeated")
+}
+
+// Reads launch file when it is set and applies flags to it
+func buildLaunch(file string, lf *launchFlags) (*Launch, error) {
+	launch := &Launch{}
+	if file != "" {
+		r, err := openLaunchFile(file)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		err = json.NewDecoder(r).Decode(launch)
+		if err != nil {
+			return nil, fmt.Errorf("invalid launch file %s: %v", file, err)
+		}
+	}
+	if lf.id != "" {
+		launch.Id = lf.id
+	}
+	if launch.Id == "" {
+		launch.Id = fmt.Sprintf("rtctl-%d", time.Now().UnixNano())
+	}
+	if lf.launchType != "" {
+		launch.Type = lf.launchType
+	}
+	if lf.container != "" {
+		launch.Container = lf.container
+	}
+	for _, name := range lf.tests {
+		launch.TestCases = append(launch.TestCases, TestCase{
+			Id:   fmt.Sprintf("%s-%d", launch.Id, len(launch.TestCases)+1),
+			Name: name,
+			Tags: lf.tags,
+		})
+	}
+	if lf.artifact != "" {
+		parts := strings.Split(lf.artifact, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("artifact should be groupId:artifactId:version: %s", lf.artifact)
+		}
+		for i := range launch.TestCases {
+			if launch.TestCases[i].Artifact == (Artifact{}) {
+				launch.TestCases[i].Artifact = Artifact{GroupId: parts[0], Id: parts[1], Version: parts[2]}
+			}
+		}
+	}
+	add := func(values []string, flag string, fn func(key string, value string) Property) error {
+		for _, kv := range values {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return fmt.Errorf("-%s should be key=value: %s", flag, kv)
+			}
+			launch.Properties = setProperty(launch.Properties, fn(parts[0], parts[1]))
+		}
+		return nil
+	}
+	err := add(lf.properties, "property", func(k string, v string) Property { return Property{Key: k, Value: v} })
+	if err == nil {
+		err = add(lf.secrets, "secret", func(k string, v string) Property { return Property{Key: k, Value: v, Secret: true} })
+	}
+	if err == nil {
+		err = add(lf.secretRefs, "secret-ref", func(k string, v string) Property { return Property{Key: k, SecretRef: v} })
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, url := range lf.webhooks {
+		launch.Webhooks = append(launch.Webhooks, Webhook{Url: url})
+	}
+	return launch, nil
+}
+
+func openLaunchFile(file string) (io.ReadCloser, error) {
+	if file == "-" {
+		return os.Stdin, nil
+	}
+	return os.Open(file)
+}
+
+// Replaces property with the same key keeping order
+func setProperty(properties []Property, p Property) []Property {
+	for i := range properties {
+		if properties[i].Key == p.Key {
+			properties[i] = p
+			return properties
+		}
+	}
+	return append(properties, p)
+}
+
+func launchCommand(args []string) int {
+	fs := flag.NewFlagSet("launch", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: rtctl launch [flags] [launch.json|-]")
+		fs.PrintDefaults()
+	}
+	var conn connection
+	conn.register(fs)
+	var lf launchFlags
+	lf.register(fs)
+	dryRun := fs.Bool("dry-run", false, "print container settings and build files without launching")
+	detach := fs.Bool("detach", false, "exit once launch is accepted without watching it")
+	artifacts := fs.String("artifacts", "", "file to save results archive to when launch finishes, .zip extension selects zip archive")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		return fail("only one launch file is expected")
+	}
+	launch, err := buildLaunch(fs.Arg(0), &lf)
+	if err != nil {
+		return fail("%v", err)
+	}
+	c, err := conn.client()
+	if err != nil {
+		return fail("%v", err)
+	}
+	if *dryRun {
+		result, err := c.Validate(launch)
+		if err != nil {
+			return fail("validate: %v", err)
+		}
+		os.Stdout.Write(result)
+		return exitPassed
+	}
+	if *detach {
+		err = c.Launch(launch)
+		if err != nil {
+			return fail("launch: %v", err)
+		}
+		fmt.Println(launch.Id)
+		return exitPassed
+	}
+	events, err := c.Events()
+	if err != nil {
+		return fail("%v", err)
+	}
+	defer events.Close()
+	err = c.Launch(launch)
+	if err != nil {
+		return fail("launch: %v", err)
+	}
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	progress := newProgress(launch, os.Stdout, isTerminal(os.Stdout))
+	interrupted, err := watch(c, events, launch.Id, progress, sig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rtctl: %v\n", err)
+		if interrupted {
+			return exitInterrupted
+		}
+	}
+	result, err := c.History(launch.Id)
+	if err != nil {
+		return fail("launch history: %v", err)
+	}
+	if result.Finished.IsZero() {
+		return fail("launch %s has not finished", launch.Id)
+	}
+	code := outcome(result)
+	progress.summary(result)
+	if *artifacts != "" {
+		err = download(c, launch.Id, *artifacts)
+		if err != nil {
+			return fail("download artifacts: %v", err)
+		}
+	}
+	if interrupted {
+		return exitInterrupted
+	}
+	return code
+}
+
+// Shows launch events until launch finishes, first signal terminates running
+// test cases and queued ones as soon as they start, second one stops watching at once
+func watch(c *client.Client, events *client.Events, launchId string, progress *progress, sig <-chan os.Signal) (bool, error) {
+	evts := make(chan event.Event)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			evt, err := events.Next()
+			if err != nil {
+				errs <- err
+				return
+			}
+			evts <- evt
+		}
+	}()
+	interrupted := false
+	for {
+		select {
+		case evt := <-evts:
+			if evt.Launch() != launchId {
+				continue
+			}
+			progress.update(evt)
+			if evt.Type == event.LaunchFinished {
+				return interrupted, nil
+			}
+			if interrupted && evt.Type == event.TestCaseStarted {
+				terminate(c, evt.Id)
+			}
+		case err := <-errs:
+			return interrupted, fmt.Errorf("event stream closed: %v", err)
+		case <-sig:
+			if interrupted {
+				return interrupted, fmt.Errorf("stopped watching launch %s", launchId)
+			}
+			interrupted = true
+			ids := progress.unfinished()
+			fmt.Fprintf(os.Stderr, "Terminating %d test cases, press Ctrl-C again to stop waiting\n", len(ids))
+			if len(ids) > 0 {
+				terminate(c, ids...)
+			}
+		}
+	}
+}
+
+func terminate(c *client.Client, testCaseIds ...string) {
+	err := c.Terminate(testCaseIds...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rtctl: terminate: %v\n", err)
+	}
+}
+
+// Outcomes of the last attempt of every launch test case
+func lastOutcomes(result *client.LaunchResult) map[string]string {
+	ret := make(map[string]string)
+	for _, tc := range result.Results {
+		ret[tc.Id] = tc.Outcome
+	}
+	return ret
+}
+
+// Launch passes when the last attempt of every test case passes
+func outcome(result *client.LaunchResult) int {
+	last := lastOutcomes(result)
+	if len(last) < len(result.TestCases) {
+		return exitFailed
+	}
+	for _, o := range last {
+		if o != store.Passed {
+			return exitFailed
+		}
+	}
+	return exitPassed
+}
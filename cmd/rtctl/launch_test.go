@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	"github.com/aerokube/rt/client"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/event"
+	"github.com/aerokube/rt/store"
+)
+
+func TestBuildLaunchFromFile(t *testing.T) {
+	launch, err := buildLaunch("../../api/test-launch.json", &launchFlags{
+		id:         "launch-1",
+		properties: listFlag{"a=b"},
+	})
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, launch.Id, EqualTo{"launch-1"})
+	AssertThat(t, launch.Type, EqualTo{"maven"})
+	AssertThat(t, len(launch.TestCases), EqualTo{2})
+	AssertThat(t, launch.Properties[len(launch.Properties)-1], EqualTo{Property{Key: "a", Value: "b"}})
+}
+
+func TestBuildLaunchFromFlags(t *testing.T) {
+	launch, err := buildLaunch("", &launchFlags{
+		id:         "launch-1",
+		launchType: "maven",
+		artifact:   "com.example:tests:1.0",
+		tests:      listFlag{"com.example.Test#one", "com.example.Test#two"},
+		tags:       listFlag{"smoke"},
+		properties: listFlag{"browser=firefox", "browser=chrome"},
+		secrets:    listFlag{"password=s3cret"},
+		secretRefs: listFlag{"token=api-token"},
+		webhooks:   listFlag{"https://example.com/hook"},
+	})
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, launch.TestCases, EqualTo{[]TestCase{
+		{Id: "launch-1-1", Name: "com.example.Test#one", Tags: []string{"smoke"}, Artifact: Artifact{GroupId: "com.example", Id: "tests", Version: "1.0"}},
+		{Id: "launch-1-2", Name: "com.example.Test#two", Tags: []string{"smoke"}, Artifact: Artifact{GroupId: "com.example", Id: "tests", Version: "1.0"}},
+	}})
+	AssertThat(t, launch.Properties, EqualTo{[]Property{
+		{Key: "browser", Value: "chrome"},
+		{Key: "password", Value: "s3cret", Secret: true},
+		{Key: "token", SecretRef: "api-token"},
+	}})
+	AssertThat(t, launch.Webhooks, EqualTo{[]Webhook{{Url: "https://example.com/hook"}}})
+}
+
+func TestBuildLaunchInvalidFlags(t *testing.T) {
+	_, err := buildLaunch("", &launchFlags{artifact: "com.example:tests"})
+	AssertThat(t, err, Is{Not{nil}})
+	_, err = buildLaunch("", &launchFlags{properties: listFlag{"browser"}})
+	AssertThat(t, err, Is{Not{nil}})
+	_, err = buildLaunch("missing.json", &launchFlags{})
+	AssertThat(t, err, Is{Not{nil}})
+}
+
+func TestOutcome(t *testing.T) {
+	result := &client.LaunchResult{
+		LaunchRecord: store.LaunchRecord{Id: "launch-1", TestCases: []string{"tc-1", "tc-2"}},
+		Results: []store.TestCaseRecord{
+			{Id: "tc-1", Outcome: store.Passed},
+			{Id: "tc-2", Outcome: store.Failed},
+			{Id: "tc-2", Outcome: store.Passed},
+		},
+	}
+	AssertThat(t, outcome(result), EqualTo{exitPassed})
+	result.Results = append(result.Results, store.TestCaseRecord{Id: "tc-1", Outcome: store.TimedOut})
+	AssertThat(t, outcome(result), EqualTo{exitFailed})
+	result.Results = result.Results[:1]
+	AssertThat(t, outcome(result), EqualTo{exitFailed})
+}
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	launch := &Launch{Id: "launch-1", TestCases: []TestCase{{Id: "tc-1", Name: "one"}, {Id: "tc-2", Name: "two"}}}
+	p := newProgress(launch, &buf, false)
+	now := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	p.update(event.Event{Type: event.TestCaseStarted, Id: "tc-1", LaunchId: "launch-1"})
+	now = now.Add(3 * time.Second)
+	p.update(event.Event{Type: event.TestCasePassed, Id: "tc-1", LaunchId: "launch-1"})
+	AssertThat(t, buf.String(), EqualTo{"10:00:00 tc-1 one running 0s\n10:00:03 tc-1 one passed 3s\n"})
+	AssertThat(t, p.unfinished(), EqualTo{[]string{"tc-2"}})
+
+	buf.Reset()
+	p.live = true
+	p.update(event.Event{Type: event.TestCaseStarted, Id: "tc-2", LaunchId: "launch-1"})
+	p.update(event.Event{Type: event.TestCaseRevoked, Id: "tc-2", LaunchId: "launch-1"})
+	AssertThat(t, bytes.Contains(buf.Bytes(), []byte("\033[4A\033[J")), Is{true})
+	AssertThat(t, bytes.Contains(buf.Bytes(), []byte("2 of 2 test cases finished")), Is{true})
+}
+
+func TestArchiveFormat(t *testing.T) {
+	AssertThat(t, archiveFormat("results.zip"), EqualTo{"zip"})
+	AssertThat(t, archiveFormat("results.tar.gz"), EqualTo{"tar.gz"})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"github.com/aerokube/rt/client"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Exit codes
+const (
+	exitPassed      = 0
+	exitFailed      = 1 // Some test cases did not pass
+	exitError       = 2 // Invalid arguments or API error
+	exitInterrupted = 130
+)
+
+const usage = `Usage: rtctl <command> [flags] [arguments]
+
+Commands:
+  launch [launch.json]         submit launch and watch its progress
+  terminate <test case id>...  terminate running test cases
+  events                       print events as they are fired
+  artifacts <launch id>        download results of launch test cases
+
+Run rtctl <command> -h to see command flags.
+`
+
+var commands = map[string]func([]string) int{
+	"launch":    launchCommand,
+	"terminate": terminateCommand,
+	"events":    eventsCommand,
+	"artifacts": artifactsCommand,
+}
+
+// Flags of every command telling how to connect to rt
+type connection struct {
+	url    string
+	token  string
+	caCert string
+	cert   string
+	key    string
+}
+
+func (conn *connection) register(fs *flag.FlagSet) {
+	url := os.Getenv("RT_URL")
+	if url == "" {
+		url = "http://localhost:8080"
+	}
+	fs.StringVar(&conn.url, "url", url, "rt URL, RT_URL environment variable by default")
+	fs.StringVar(&conn.token, "token", os.Getenv("RT_TOKEN"), "API token, RT_TOKEN environment variable by default")
+	fs.StringVar(&conn.caCert, "ca-cert", "", "PEM CA bundle to verify rt certificate with")
+	fs.StringVar(&conn.cert, "cert", "", "PEM client certificate file")
+	fs.StringVar(&conn.key, "key", "", "PEM private key file for -cert")
+}
+
+func (conn *connection) client() (*client.Client, error) {
+	c := client.New(conn.url, conn.token)
+	if conn.caCert == "" && conn.cert == "" && conn.key == "" {
+		return c, nil
+	}
+	conf := &tls.Config{MinVersion: tls.VersionTLS12}
+	if conn.caCert != "" {
+		pem, err := ioutil.ReadFile(conn.caCert)
+		if err != nil {
+			return nil, fmt.Errorf("load CA: %v", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("load CA: no certificates found in %s", conn.caCert)
+		}
+	}
+	if conn.cert != "" || conn.key != "" {
+		cert, err := tls.LoadX509KeyPair(conn.cert, conn.key)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %v", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	c.TLSConfig = conf
+	return c, nil
+}
+
+// Repeatable flag
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func fail(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "rtctl: "+format+"\n", args...)
+	return exitError
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitError)
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+			fmt.Print(usage)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "rtctl: unknown command: %s\n\n%s", os.Args[1], usage)
+		os.Exit(exitError)
+	}
+	os.Exit(command(os.Args[2:]))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aerokube/rt/client"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/event"
+	"github.com/aerokube/rt/store"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Test case is neither started nor finished yet
+const queued = "queued"
+
+// Test case status after event
+var statuses = map[string]string{
+	event.TestCaseStarted:    store.Running,
+	event.TestCaseNotStarted: store.NotStarted,
+	event.TestCasePassed:     store.Passed,
+	event.TestCaseFailed:     store.Failed,
+	event.TestCaseRevoked:    store.Revoked,
+	event.TestCaseTimedOut:   store.TimedOut,
+}
+
+type testCaseProgress struct {
+	id       string
+	name     string
+	status   string
+	started  time.Time
+	finished time.Time
+}
+
+func (tc *testCaseProgress) duration(now time.Time) string {
+	switch {
+	case tc.started.IsZero():
+		return ""
+	case tc.finished.IsZero():
+		return now.Sub(tc.started).Round(time.Second).String()
+	default:
+		return tc.finished.Sub(tc.started).Round(time.Second).String()
+	}
+}
+
+// Shows test case statuses either as a table redrawn in place or as a line per change
+type progress struct {
+	out      io.Writer
+	live     bool
+	launchId string
+	rows     []*testCaseProgress
+	byId     map[string]*testCaseProgress
+	lines    int // Printed by previous redraw
+	now      func() time.Time
+}
+
+func newProgress(launch *Launch, out io.Writer, live bool) *progress {
+	p := &progress{
+		out:      out,
+		live:     live,
+		launchId: launch.Id,
+		byId:     make(map[string]*testCaseProgress),
+		now:      time.Now,
+	}
+	for _, tc := range launch.TestCases {
+		row := &testCaseProgress{id: tc.Id, name: tc.Name, status: queued}
+		p.rows = append(p.rows, row)
+		p.byId[tc.Id] = row
+	}
+	return p
+}
+
+func (p *progress) update(evt event.Event) {
+	row, ok := p.byId[evt.Id]
+	status, isTestCaseEvent := statuses[evt.Type]
+	if isTestCaseEvent && ok {
+		now := p.now()
+		if status == store.Running {
+			row.started = now
+		} else {
+			row.finished = now
+		}
+		row.status = status
+	}
+	if p.live {
+		p.redraw()
+		return
+	}
+	switch {
+	case evt.Type == event.LaunchStarted:
+		fmt.Fprintf(p.out, "%s launch %s started\n", p.now().Format("15:04:05"), p.launchId)
+	case evt.Type == event.LaunchFinished:
+		fmt.Fprintf(p.out, "%s launch %s finished\n", p.now().Format("15:04:05"), p.launchId)
+	case isTestCaseEvent && ok:
+		fmt.Fprintf(p.out, "%s %s %s %s %s\n", p.now().Format("15:04:05"), row.id, row.name, row.status, row.duration(p.now()))
+	}
+}
+
+func (p *progress) redraw() {
+	var buf bytes.Buffer
+	if p.lines > 0 {
+		fmt.Fprintf(&buf, "\033[%dA\033[J", p.lines)
+	}
+	finished := 0
+	for _, row := range p.rows {
+		if !row.finished.IsZero() {
+			finished++
+		}
+	}
+	var table bytes.Buffer
+	fmt.Fprintf(&table, "Launch %s: %d of %d test cases finished\n", p.launchId, finished, len(p.rows))
+	w := tabwriter.NewWriter(&table, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TEST CASE\tNAME\tSTATUS\tDURATION")
+	now := p.now()
+	for _, row := range p.rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", row.id, row.name, row.status, row.duration(now))
+	}
+	w.Flush()
+	p.lines = strings.Count(table.String(), "\n")
+	buf.Write(table.Bytes())
+	p.out.Write(buf.Bytes())
+}
+
+// Test cases that are queued or running
+func (p *progress) unfinished() []string {
+	var ret []string
+	for _, row := range p.rows {
+		if row.status == queued || row.status == store.Running {
+			ret = append(ret, row.id)
+		}
+	}
+	return ret
+}
+
+// Prints number of test cases by outcome of their last attempt
+func (p *progress) summary(result *client.LaunchResult) {
+	counts := make(map[string]int)
+	for _, outcome := range lastOutcomes(result) {
+		counts[outcome]++
+	}
+	var parts []string
+	for outcome, n := range counts {
+		parts = append(parts, fmt.Sprintf("%d %s", n, outcome))
+	}
+	sort.Strings(parts)
+	fmt.Fprintf(p.out, "Launch %s finished in %s: %s\n", result.Id, result.Finished.Sub(result.Started).Round(time.Second), strings.Join(parts, ", "))
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -4,4 +4,9 @@ const (
 	DataDir   = "DATA_DIR"
 	Templates = "TEMPLATES"
 	BuildData = "BUILD_DATA"
+
+	SecretsFile = "SECRETS_FILE" // Path to secret properties file
+
+	TraceParent = "TRACEPARENT" // W3C trace context of test case span
+	TraceId     = "TRACE_ID"
 )
@@ -5,8 +5,38 @@ type RequestId uint64
 
 // Includes flags, tests in parallel
 type Property struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Secret    bool   `json:"secret,omitempty"`    // Value is only delivered to container in a file
+	SecretRef string `json:"secretRef,omitempty"` // Name of secret from rt secrets file to use as value
+}
+
+// Shown instead of secret property values
+const Masked = "****"
+
+// IsSecret tells whether property value should never be shown
+func (p Property) IsSecret() bool {
+	return p.Secret || p.SecretRef != ""
+}
+
+// String never contains secret value
+func (p Property) String() string {
+	if p.IsSecret() {
+		return p.Key + "=" + Masked
+	}
+	return p.Key + "=" + p.Value
+}
+
+// MaskProperties returns a copy of properties with secret values replaced by Masked
+func MaskProperties(properties []Property) []Property {
+	var ret []Property
+	for _, p := range properties {
+		if p.IsSecret() {
+			p.Value = Masked
+		}
+		ret = append(ret, p)
+	}
+	return ret
 }
 
 // Artifact with tests like Maven or NPM artifact
@@ -26,14 +56,26 @@ type TestCase struct {
 
 // Data passed to each container
 type StandaloneTestCase struct {
-	TestCase   TestCase
-	Properties []Property
+	TestCase    TestCase
+	Properties  []Property // Without secret properties
+	SecretsFile string     // Java properties file with secret properties, empty when there are none
 }
 
 // A set of test cases launched in the same request
 type Launch struct {
 	Id         string     `json:"id"`
-	Type       string     `json:"type"` //I.e. which technology is being used
+	Type       string     `json:"type"`      //I.e. which technology is being used
+	Container  string     `json:"container"` //Container variant for this technology, e.g. maven-jdk8
 	TestCases  []TestCase `json:"testcases"`
 	Properties []Property `json:"properties"`
+	Webhooks   []Webhook  `json:"webhooks"`
+	Owner      string     `json:"-"` // Set from API token
+	Client     string     `json:"-"` // API token or client IP active test cases are counted for
+}
+
+// URL to send events to
+type Webhook struct {
+	Url    string   `json:"url" yaml:"url"`
+	Events []string `json:"events" yaml:"events"` // Event types to send, all when empty
+	Secret string   `json:"secret" yaml:"secret"` // Payloads are signed with HMAC-SHA256 when set
 }
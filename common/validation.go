@@ -0,0 +1,13 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validation error listing all problems as "<field path>: <problem>"
+type ValidationError []string
+
+func (ve ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n\t%s", strings.Join(ve, "\n\t"))
+}
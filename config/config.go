@@ -1,11 +1,21 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/aerokube/rt/auth"
+	"github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/webhook"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+	"gopkg.in/yaml.v2"
 	"io/ioutil"
-	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -14,67 +24,471 @@ import (
 type Containers map[string]Container
 
 type Container struct {
-	Image     string            `json:"image"`
-	DataDir   string            `json:"dataDir"`
-	Tmpfs     map[string]string `json:"tmpfs"`
-	Templates map[string]string `json:"templates"`
-	Volumes   []string          `json:"volumes"`
+	Extends   string            `json:"extends" yaml:"extends"` // Container type to inherit settings from
+	Tool      string            `json:"tool" yaml:"tool"`       // Defaults to container type
+	Default   bool              `json:"default" yaml:"default"` // Used for launches not specifying container
+	Image     string            `json:"image" yaml:"image"`
+	DataDir   string            `json:"dataDir" yaml:"dataDir"`
+	Tmpfs     map[string]string `json:"tmpfs" yaml:"tmpfs"`
+	Templates map[string]string `json:"templates" yaml:"templates"`
+	Volumes   []string          `json:"volumes" yaml:"volumes"`
+	Env       map[string]string `json:"env" yaml:"env"`
+	Limits    Limits            `json:"limits" yaml:"limits"`
+}
+
+// Container resource limits
+type Limits struct {
+	Memory string  `json:"memory" yaml:"memory"` // E.g. 512m or 2g
+	CPUs   float64 `json:"cpus" yaml:"cpus"`
+}
+
+// Memory limit in bytes, zero means no limit
+func (l Limits) MemoryBytes() (int64, error) {
+	if l.Memory == "" {
+		return 0, nil
+	}
+	return units.RAMInBytes(l.Memory)
 }
 
 // Config current configuration
 type Config struct {
 	lock            sync.RWMutex
 	containers      map[string]Container
-	LogConfig       *container.LogConfig
+	logConfig       *container.LogConfig
+	containersPath  string
+	loaded          time.Time
+	logConfigPath   string
+	webhooks        []common.Webhook
+	webhooksPath    string
+	tokens          []auth.Token
+	tokensPath      string
+	secrets         map[string]string
+	secretsPath     string
 	DataDir         string
+	StateFiles      []string // Files rt keeps in data directory, they are never removed as launch results
+	SecretsDir      string   // Host directory for secret properties files mounted to containers
 	Timeout         time.Duration
 	ShutdownTimeout time.Duration
+	StopTimeout     time.Duration // Time terminated container gets to exit before it is killed, zero kills it at once
+	Tools           []string      // Supported tools, container types are not checked when empty
+	InstanceId      string        // Distinguishes containers started by this rt instance
+	RecoveryPolicy  string        // What to do with containers left after restart
+	GCInterval      time.Duration
+	GCGrace         time.Duration
+	Retention       Retention
+	LaunchLimits    LaunchLimits
+	RateLimits      RateLimits
+	MinFreeDisk     int64    // Bytes in data directory required to be ready, zero disables the check
+	WebhookUrls     []string // URL prefixes launch webhooks are allowed to post to, launch webhooks are refused when empty
+	ClientCerts     bool     // Clients have to present verified TLS certificates
+	// Reads template files from image, templates are checked to exist on reload when set
+	ReadTemplates func(image string, paths []string) (map[string]string, error)
+}
+
+// Which launch directories to keep in data directory, zero values mean no limit
+type Retention struct {
+	Interval time.Duration // How often to clean data directory, zero disables cleaning
+	MaxAge   time.Duration
+	MaxSize  int64 // Bytes
+	KeepLast int   // Number of most recent launches
+}
+
+// Limits protecting rt from malformed launch requests, zero values mean no limit
+type LaunchLimits struct {
+	MaxBodySize    int64 // Bytes
+	MaxTestCases   int
+	MaxValueLength int // Characters in IDs, names, tags and property values
+}
+
+// Limits per API token or client IP, zero values mean no limit
+type RateLimits struct {
+	Rate               float64 // Launch and terminate requests per second
+	Burst              int     // Requests allowed at once before rate applies
+	MaxActiveTestCases int     // Queued and running test cases per API token or client IP
+}
+
+var DefaultLaunchLimits = LaunchLimits{
+	MaxBodySize:    10 * 1024 * 1024,
+	MaxTestCases:   1000,
+	MaxValueLength: 4096,
 }
 
 // NewConfig creates new config
 func NewConfig(dataDir string, timeout time.Duration, shutdownTimeout time.Duration) *Config {
 	return &Config{
 		containers:      make(map[string]Container),
-		LogConfig:       new(container.LogConfig),
+		logConfig:       new(container.LogConfig),
 		DataDir:         dataDir,
+		SecretsDir:      filepath.Join(os.TempDir(), "rt-secrets"),
+		LaunchLimits:    DefaultLaunchLimits,
 		Timeout:         timeout,
 		ShutdownTimeout: shutdownTimeout,
 	}
 }
 
+// Load reads both configuration files and replaces current configuration.
+// Containers configuration can also be a directory with files merged in lexical order.
+// Current configuration is left untouched when containers file is invalid.
 func (c *Config) Load(containers, containerLogs string) error {
-	log.Println("Loading configuration files...")
-	ct := make(Containers)
-	err := loadJSON(containers, &ct)
+	logging.Info("LOADING_CONFIG")
+	ct, err := readContainers(containers, c.Tools)
 	if err != nil {
-		return fmt.Errorf("containers config: %v", err)
+		return err
 	}
-	log.Printf("Loaded configuration from [%s]\n", containers)
-	var cl *container.LogConfig
-	err = loadJSON(containerLogs, &cl)
+	cl, logErr := readLogConfig(containerLogs)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.setLogConfig(containerLogs, cl, logErr)
+	c.containers, c.containersPath = ct, containers
+	c.loaded = time.Now()
+	logging.With("path", containers).Info("CONFIG_LOADED")
+	return nil
+}
+
+// Reload loads configuration again from the files it was last loaded from.
+// All files are read before applying any of them, so current configuration is
+// left untouched when one of them is invalid.
+func (c *Config) Reload() error {
+	c.lock.RLock()
+	containers, containerLogs, webhooksPath, tokensPath, secretsPath := c.containersPath, c.logConfigPath, c.webhooksPath, c.tokensPath, c.secretsPath
+	c.lock.RUnlock()
+	logging.Info("LOADING_CONFIG")
+	ct, err := readContainers(containers, c.Tools)
+	if err != nil {
+		return err
+	}
+	err = checkTemplates(ct, c.ReadTemplates)
+	if err != nil {
+		return err
+	}
+	cl, logErr := readLogConfig(containerLogs)
+	var (
+		hooks   []common.Webhook
+		tokens  []auth.Token
+		secrets map[string]string
+	)
+	if webhooksPath != "" {
+		hooks, err = readWebhooks(webhooksPath)
+		if err != nil {
+			return err
+		}
+	}
+	if tokensPath != "" {
+		tokens, err = readTokens(tokensPath)
+		if err != nil {
+			return err
+		}
+	}
+	if secretsPath != "" {
+		secrets, err = readSecrets(secretsPath)
+		if err != nil {
+			return err
+		}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.setLogConfig(containerLogs, cl, logErr)
+	c.containers = ct
+	c.loaded = time.Now()
+	logging.With("path", containers).Info("CONFIG_LOADED")
+	if webhooksPath != "" {
+		c.webhooks = hooks
+		logging.With("path", webhooksPath).With("webhooks", len(hooks)).Info("WEBHOOKS_LOADED")
+	}
+	if tokensPath != "" {
+		c.tokens = tokens
+		logging.With("path", tokensPath).With("tokens", len(tokens)).Info("TOKENS_LOADED")
+	}
+	if secretsPath != "" {
+		c.secrets = secrets
+		logging.With("path", secretsPath).With("secrets", len(secrets)).Info("SECRETS_LOADED")
+	}
+	return nil
+}
+
+// Broken log configuration is replaced with default one on first load only,
+// afterwards current one is kept. Should be called with lock held.
+func (c *Config) setLogConfig(path string, cl *container.LogConfig, err error) {
+	c.logConfigPath = path
+	switch {
+	case err == nil:
+		c.logConfig = cl
+		logging.With("path", path).Info("LOG_CONFIG_LOADED")
+	case c.loaded.IsZero():
+		c.logConfig = &container.LogConfig{}
+		logging.With("path", path).Err(err).Warn("USING_DEFAULT_LOG_CONFIG")
+	default:
+		logging.With("path", path).Err(err).Warn("KEEPING_CURRENT_LOG_CONFIG")
+	}
+}
+
+// LoadWebhooks reads global webhooks from JSON or YAML file keeping current ones when file is invalid
+func (c *Config) LoadWebhooks(filename string) error {
+	hooks, err := readWebhooks(filename)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.webhooks, c.webhooksPath = hooks, filename
+	logging.With("path", filename).With("webhooks", len(hooks)).Info("WEBHOOKS_LOADED")
+	return nil
+}
+
+// LoadTokens reads API tokens from JSON or YAML file and enables authentication.
+// Current tokens are kept when file is invalid.
+func (c *Config) LoadTokens(filename string) error {
+	tokens, err := readTokens(filename)
 	if err != nil {
-		log.Printf("Using default containers log configuration because of: %v\n", err)
-		cl = &container.LogConfig{}
-	} else {
-		log.Printf("Loaded log configuration from [%s]\n", containerLogs)
+		return err
 	}
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	c.containers, c.LogConfig = ct, cl
+	c.tokens, c.tokensPath = tokens, filename
+	logging.With("path", filename).With("tokens", len(tokens)).Info("TOKENS_LOADED")
+	return nil
+}
+
+// LoadSecrets reads named secrets that launch properties can reference from JSON or YAML file.
+// Current secrets are kept when file is invalid.
+func (c *Config) LoadSecrets(filename string) error {
+	secrets, err := readSecrets(filename)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.secrets, c.secretsPath = secrets, filename
+	logging.With("path", filename).With("secrets", len(secrets)).Info("SECRETS_LOADED")
+	return nil
+}
+
+// Secret returns value of named secret
+func (c *Config) Secret(name string) (string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	value, ok := c.secrets[name]
+	return value, ok
+}
+
+// Tokens returns API tokens and whether authentication is enabled
+func (c *Config) Tokens() ([]auth.Token, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.tokens, c.tokensPath != ""
+}
+
+// Webhooks returns webhooks receiving events of all launches
+func (c *Config) Webhooks() []common.Webhook {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.webhooks
+}
+
+func readContainers(filename string, tools []string) (Containers, error) {
+	ct, err := loadContainers(filename)
+	if err != nil {
+		return nil, fmt.Errorf("containers config: %v", err)
+	}
+	err = ct.Validate(tools)
+	if err != nil {
+		return nil, fmt.Errorf("containers config: %v", err)
+	}
+	return ct, nil
+}
+
+// CheckTemplates checks that templates of current containers exist in their images
+func (c *Config) CheckTemplates() error {
+	c.lock.RLock()
+	ct := c.containers
+	c.lock.RUnlock()
+	return checkTemplates(ct, c.ReadTemplates)
+}
+
+func checkTemplates(ct Containers, read func(image string, paths []string) (map[string]string, error)) error {
+	if read == nil {
+		return nil
+	}
+	err := ct.CheckTemplates(read)
+	if err != nil {
+		return fmt.Errorf("containers config: %v", err)
+	}
 	return nil
 }
 
-func loadJSON(filename string, v interface{}) error {
+func readLogConfig(filename string) (*container.LogConfig, error) {
+	var cl *container.LogConfig
+	err := loadFile(filename, &cl)
+	if err != nil {
+		return nil, err
+	}
+	cl.Config = expandEnvMap(cl.Config)
+	return cl, nil
+}
+
+func readWebhooks(filename string) ([]common.Webhook, error) {
+	var hooks []common.Webhook
+	err := loadFile(filename, &hooks)
+	if err != nil {
+		return nil, fmt.Errorf("webhooks config: %v", err)
+	}
+	for i := range hooks {
+		hooks[i].Url = expandEnv(hooks[i].Url)
+		hooks[i].Secret = expandEnv(hooks[i].Secret)
+	}
+	err = webhook.Validate(hooks)
+	if err != nil {
+		return nil, fmt.Errorf("webhooks config: %v", err)
+	}
+	return hooks, nil
+}
+
+func readTokens(filename string) ([]auth.Token, error) {
+	var tokens []auth.Token
+	err := loadFile(filename, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("tokens config: %v", err)
+	}
+	err = auth.Validate(tokens)
+	if err != nil {
+		return nil, fmt.Errorf("tokens config: %v", err)
+	}
+	return tokens, nil
+}
+
+func readSecrets(filename string) (map[string]string, error) {
+	var secrets map[string]string
+	err := loadFile(filename, &secrets)
+	if err != nil {
+		return nil, fmt.Errorf("secrets config: %v", err)
+	}
+	var problems common.ValidationError
+	for name, value := range secrets {
+		value = expandEnv(value)
+		if value == "" {
+			problems = append(problems, fmt.Sprintf("%s: empty value", name))
+		}
+		secrets[name] = value
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("secrets config: %v", problems)
+	}
+	return secrets, nil
+}
+
+func loadContainers(filename string) (Containers, error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read config file: %v", err)
+	}
+	if !fi.IsDir() {
+		ct := make(Containers)
+		err := loadFile(filename, &ct)
+		if err != nil {
+			return nil, err
+		}
+		return ct.expandEnv().resolve()
+	}
+	files, err := ioutil.ReadDir(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read config directory: %v", err)
+	}
+	ct := make(Containers)
+	for _, f := range files {
+		if f.IsDir() || !isConfigFile(f.Name()) {
+			continue
+		}
+		part := make(Containers)
+		partFilename := filepath.Join(filename, f.Name())
+		err := loadFile(partFilename, &part)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", partFilename, err)
+		}
+		for containerType, container := range part {
+			ct[containerType] = container
+		}
+	}
+	return ct.expandEnv().resolve()
+}
+
+func isConfigFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json", ".yml", ".yaml":
+		return true
+	}
+	return false
+}
+
+// Loads JSON or YAML file depending on its extension
+func loadFile(filename string, v interface{}) error {
 	buf, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return fmt.Errorf("Failed to read config file: %v", err)
 	}
-	if err := json.Unmarshal(buf, v); err != nil {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yml", ".yaml":
+		err = yaml.UnmarshalStrict(buf, v)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(buf))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(v)
+	}
+	if err != nil {
 		return fmt.Errorf("Failed to read config file: %v", err)
 	}
 	return nil
 }
 
+func (c *Config) LogConfig() *container.LogConfig {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.logConfig
+}
+
+// FindContainer returns container for the tool and its type. When container type is empty
+// either container marked as default or container with the same name as tool is returned.
+func (c *Config) FindContainer(tool string, containerType string) (*Container, string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if containerType == "" {
+		containerType = tool
+		for t, ct := range c.containers {
+			if ct.Tool == tool && ct.Default {
+				containerType = t
+				break
+			}
+		}
+	}
+	if ct, ok := c.containers[containerType]; ok && ct.Tool == tool {
+		return &ct, containerType, true
+	}
+	return nil, "", false
+}
+
+// LoadedAt returns when containers configuration was last loaded
+func (c *Config) LoadedAt() time.Time {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.loaded
+}
+
+// Images returns sorted images of all configured containers
+func (c *Config) Images() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	images := make(map[string]bool)
+	for _, ct := range c.containers {
+		images[ct.Image] = true
+	}
+	var ret []string
+	for image := range images {
+		ret = append(ret, image)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
 func (c *Config) GetContainer(containerType string) (*Container, bool) {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
@@ -1,6 +1,11 @@
 package config
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 	. "github.com/aandryashin/matchers"
@@ -23,7 +28,7 @@ func TestLoadCorrectConfig(t *testing.T) {
 	AssertThat(t, config.DataDir, EqualTo{dataDir})
 	AssertThat(t, config.Timeout, EqualTo{timeout})
 	AssertThat(t, config.ShutdownTimeout, EqualTo{shutdownTimeout})
-	AssertThat(t, *config.LogConfig, EqualTo{container.LogConfig{Type: "json-file"}})
+	AssertThat(t, *config.LogConfig(), EqualTo{container.LogConfig{Type: "json-file"}})
 	
 	ct, exists := config.GetContainer("maven")
 	AssertThat(t, exists, Is{true})
@@ -42,6 +47,255 @@ func TestLoadBrokenConfig(t *testing.T) {
 }
 
 func TestLoadMissingLogConfig(t *testing.T) {
-	AssertThat(t, config.Load("test-config.json", "missing.json"), Is{nil})
-	AssertThat(t, *config.LogConfig, EqualTo{container.LogConfig{}})
-}
\ No newline at end of file
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	AssertThat(t, conf.Load("test-config.json", "missing.json"), Is{nil})
+	AssertThat(t, *conf.LogConfig(), EqualTo{container.LogConfig{}})
+}
+
+func TestReloadKeepsLogConfigOnError(t *testing.T) {
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	AssertThat(t, conf.Load("test-config.json", "test-log-config.json"), Is{nil})
+	AssertThat(t, conf.Load("test-config.json", "missing.json"), Is{nil})
+	AssertThat(t, *conf.LogConfig(), EqualTo{container.LogConfig{Type: "json-file"}})
+}
+
+func TestReloadIsAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rt-config")
+	AssertThat(t, err, Is{nil})
+	defer os.RemoveAll(dir)
+	copyFile := func(from string, to string) {
+		data, err := ioutil.ReadFile(from)
+		AssertThat(t, err, Is{nil})
+		AssertThat(t, ioutil.WriteFile(filepath.Join(dir, to), data, 0644), Is{nil})
+	}
+	copyFile("test-config.json", "containers.json")
+	copyFile("test-log-config.json", "log-config.json")
+	copyFile("test-tokens.yml", "tokens.yml")
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	AssertThat(t, conf.Load(filepath.Join(dir, "containers.json"), filepath.Join(dir, "log-config.json")), Is{nil})
+	AssertThat(t, conf.LoadTokens(filepath.Join(dir, "tokens.yml")), Is{nil})
+
+	copyFile("variants-config.json", "containers.json")
+	copyFile("invalid-tokens.json", "tokens.yml")
+	AssertThat(t, conf.Reload(), Is{Not{nil}})
+	_, exists := conf.GetContainer("maven")
+	AssertThat(t, exists, Is{true})
+	tokens, _ := conf.Tokens()
+	AssertThat(t, len(tokens), EqualTo{2})
+
+	copyFile("test-tokens.yml", "tokens.yml")
+	AssertThat(t, conf.Reload(), Is{nil})
+	_, exists = conf.GetContainer("maven")
+	AssertThat(t, exists, Is{false})
+}
+
+func TestReloadKeepsOldConfigOnError(t *testing.T) {
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	AssertThat(t, conf.Load("test-config.json", "test-log-config.json"), Is{nil})
+	AssertThat(t, conf.Reload(), Is{nil})
+	AssertThat(t, conf.Load("broken-config.json", "test-log-config.json"), Is{Not{nil}})
+	_, exists := conf.GetContainer("maven")
+	AssertThat(t, exists, Is{true})
+}
+
+func TestCheckTemplates(t *testing.T) {
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	AssertThat(t, conf.Load("test-config.json", "test-log-config.json"), Is{nil})
+	AssertThat(t, conf.CheckTemplates(), Is{nil})
+
+	var images []string
+	conf.ReadTemplates = func(image string, paths []string) (map[string]string, error) {
+		images = append(images, image)
+		return nil, fmt.Errorf("failed to read template %s: not a regular file", paths[0])
+	}
+	err := conf.CheckTemplates()
+	AssertThat(t, err, Is{Not{nil}})
+	AssertThat(t, strings.Contains(err.Error(), "maven.templates: failed to read template"), Is{true})
+	AssertThat(t, conf.Reload(), Is{Not{nil}})
+	_, exists := conf.GetContainer("maven")
+	AssertThat(t, exists, Is{true})
+
+	conf.ReadTemplates = func(image string, paths []string) (map[string]string, error) {
+		return map[string]string{}, nil
+	}
+	AssertThat(t, conf.Reload(), Is{nil})
+	AssertThat(t, len(images) > 0, Is{true})
+}
+
+func TestLoadInvalidConfig(t *testing.T) {
+	err := NewConfig(dataDir, timeout, shutdownTimeout).Load("invalid-config.json", "test-log-config.json")
+	AssertThat(t, err, Is{Not{nil}})
+	AssertThat(t, err.Error(), EqualTo{`containers config: invalid configuration:
+	maven.image: must not be empty
+	maven.dataDir: must be an absolute path, got "data"
+	maven.tmpfs: mount point must be an absolute path, got "tmp"
+	maven.templates: output file for "/pom.xml.tmpl" must be an absolute path, got "pom.xml"
+	maven.volumes[0]: expected "<source>:<destination>[:<options>]", got "/root/.m2"`})
+}
+
+func TestLoadConfigWithUnknownField(t *testing.T) {
+	err := NewConfig(dataDir, timeout, shutdownTimeout).Load("unknown-field-config.json", "test-log-config.json")
+	AssertThat(t, err, Is{Not{nil}})
+}
+
+func TestLoadConfigWithUnsupportedTool(t *testing.T) {
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	conf.Tools = []string{"npm"}
+	AssertThat(t, conf.Load("test-config.json", "test-log-config.json"), Is{Not{nil}})
+	conf.Tools = []string{"maven", "npm"}
+	AssertThat(t, conf.Load("test-config.json", "test-log-config.json"), Is{nil})
+}
+
+func TestValidateVolume(t *testing.T) {
+	AssertThat(t, validateVolume("/root/.m2:/root/.m2"), Is{nil})
+	AssertThat(t, validateVolume("m2-cache:/root/.m2:ro,z"), Is{nil})
+	AssertThat(t, validateVolume("root/.m2:/root/.m2"), Is{Not{nil}})
+	AssertThat(t, validateVolume("/root/.m2:root/.m2"), Is{Not{nil}})
+	AssertThat(t, validateVolume("/root/.m2:/root/.m2:readonly"), Is{Not{nil}})
+	AssertThat(t, validateVolume("/a:/b:ro:extra"), Is{Not{nil}})
+}
+
+func TestLoadYAMLConfigWithEnv(t *testing.T) {
+	os.Setenv("RT_TEST_M2_DIR", "/home/user/.m2")
+	defer os.Unsetenv("RT_TEST_M2_DIR")
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	AssertThat(t, conf.Load("test-config.yml", "test-log-config.json"), Is{nil})
+	ct, exists := conf.GetContainer("maven")
+	AssertThat(t, exists, Is{true})
+	AssertThat(t, ct.Image, EqualTo{"aerokube/maven:latest"})
+	AssertThat(t, ct.Volumes, EqualTo{[]string{"/home/user/.m2:/root/.m2"}})
+	AssertThat(t, ct.Env, EqualTo{map[string]string{"MAVEN_OPTS": "-Xmx512m"}})
+}
+
+func TestLoadConfigDirectory(t *testing.T) {
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	AssertThat(t, conf.Load("conf.d", "test-log-config.json"), Is{nil})
+	ct, exists := conf.GetContainer("maven")
+	AssertThat(t, exists, Is{true})
+	AssertThat(t, ct.Image, EqualTo{"aerokube/maven:latest"})
+}
+
+func TestImages(t *testing.T) {
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	AssertThat(t, conf.LoadedAt().IsZero(), Is{true})
+	AssertThat(t, conf.Load("variants-config.json", "test-log-config.json"), Is{nil})
+	AssertThat(t, conf.LoadedAt().IsZero(), Is{false})
+	images := conf.Images()
+	AssertThat(t, len(images) > 0, Is{true})
+	for i := 1; i < len(images); i++ {
+		AssertThat(t, images[i-1] < images[i], Is{true})
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("RT_TEST_TAG", "3.5")
+	defer os.Unsetenv("RT_TEST_TAG")
+	AssertThat(t, expandEnv("maven:${RT_TEST_TAG}"), EqualTo{"maven:3.5"})
+	AssertThat(t, expandEnv("maven:${RT_TEST_TAG:-latest}"), EqualTo{"maven:3.5"})
+	AssertThat(t, expandEnv("maven:${RT_TEST_MISSING:-latest}"), EqualTo{"maven:latest"})
+	AssertThat(t, expandEnv("maven:${RT_TEST_MISSING}"), EqualTo{"maven:"})
+	AssertThat(t, expandEnv("maven:$RT_TEST_TAG"), EqualTo{"maven:$RT_TEST_TAG"})
+}
+
+func TestLoadConfigWithExtends(t *testing.T) {
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	AssertThat(t, conf.Load("extends-config.json", "test-log-config.json"), Is{nil})
+	ct, exists := conf.GetContainer("maven-jdk8")
+	AssertThat(t, exists, Is{true})
+	AssertThat(t, *ct, EqualTo{Container{
+		Extends:   "maven",
+		Tool:      "maven",
+		Image:     "aerokube/maven:jdk8",
+		DataDir:   "/data",
+		Tmpfs:     map[string]string{"/tmp": "size=256m"},
+		Templates: map[string]string{"/pom.xml.tmpl": "/data/pom.xml"},
+		Volumes:   []string{"/root/.m2:/root/.m2", "/opt/jdk8-certs:/certs:ro"},
+		Env:       map[string]string{"MAVEN_OPTS": "-Xmx512m", "JAVA_VERSION": "8"},
+		Limits:    Limits{Memory: "1g", CPUs: 2},
+	}})
+}
+
+func TestLoadConfigWithCircularExtends(t *testing.T) {
+	err := NewConfig(dataDir, timeout, shutdownTimeout).Load("circular-config.json", "test-log-config.json")
+	AssertThat(t, err, Is{Not{nil}})
+}
+
+func TestFindContainer(t *testing.T) {
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	AssertThat(t, conf.Load("extends-config.json", "test-log-config.json"), Is{nil})
+
+	ct, containerType, ok := conf.FindContainer("maven", "")
+	AssertThat(t, ok, Is{true})
+	AssertThat(t, containerType, EqualTo{"maven"})
+	AssertThat(t, ct.Image, EqualTo{"aerokube/maven:latest"})
+
+	ct, containerType, ok = conf.FindContainer("maven", "maven-jdk8")
+	AssertThat(t, ok, Is{true})
+	AssertThat(t, containerType, EqualTo{"maven-jdk8"})
+	AssertThat(t, ct.Image, EqualTo{"aerokube/maven:jdk8"})
+
+	_, _, ok = conf.FindContainer("maven", "missing")
+	AssertThat(t, ok, Is{false})
+	_, _, ok = conf.FindContainer("npm", "maven-jdk8")
+	AssertThat(t, ok, Is{false})
+}
+
+func TestFindDefaultContainer(t *testing.T) {
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	AssertThat(t, conf.Load("variants-config.json", "test-log-config.json"), Is{nil})
+	_, containerType, ok := conf.FindContainer("maven", "")
+	AssertThat(t, ok, Is{true})
+	AssertThat(t, containerType, EqualTo{"maven-jdk17"})
+}
+
+func TestLoadWebhooks(t *testing.T) {
+	os.Setenv("RT_TEST_WEBHOOK_SECRET", "s3cr3t")
+	defer os.Unsetenv("RT_TEST_WEBHOOK_SECRET")
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	err := conf.LoadWebhooks("test-webhooks.yml")
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, len(conf.Webhooks()), EqualTo{1})
+	hook := conf.Webhooks()[0]
+	AssertThat(t, hook.Url, EqualTo{"https://chat.example.com/hooks/rt"})
+	AssertThat(t, hook.Events, EqualTo{[]string{"launch_finished", "test_case_failed"}})
+	AssertThat(t, hook.Secret, EqualTo{"s3cr3t"})
+
+	err = conf.LoadWebhooks("invalid-webhooks.json")
+	AssertThat(t, err, Is{Not{nil}})
+	AssertThat(t, len(conf.Webhooks()), EqualTo{1})
+}
+
+func TestLoadTokens(t *testing.T) {
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	_, enabled := conf.Tokens()
+	AssertThat(t, enabled, Is{false})
+
+	err := conf.LoadTokens("test-tokens.yml")
+	AssertThat(t, err, Is{nil})
+	tokens, enabled := conf.Tokens()
+	AssertThat(t, enabled, Is{true})
+	AssertThat(t, len(tokens), EqualTo{2})
+	AssertThat(t, tokens[0].Name, EqualTo{"team-a"})
+	AssertThat(t, tokens[1].Scopes, EqualTo{[]string{"admin"}})
+
+	err = conf.LoadTokens("invalid-tokens.json")
+	AssertThat(t, err, Is{Not{nil}})
+	tokens, _ = conf.Tokens()
+	AssertThat(t, len(tokens), EqualTo{2})
+}
+
+func TestLoadSecrets(t *testing.T) {
+	conf := NewConfig(dataDir, timeout, shutdownTimeout)
+	err := conf.LoadSecrets("test-secrets.yml")
+	AssertThat(t, err, Is{Not{nil}})
+
+	os.Setenv("RT_TEST_DB_PASSWORD", "s3cr3t")
+	defer os.Unsetenv("RT_TEST_DB_PASSWORD")
+	err = conf.LoadSecrets("test-secrets.yml")
+	AssertThat(t, err, Is{nil})
+	value, ok := conf.Secret("db-password")
+	AssertThat(t, ok, Is{true})
+	AssertThat(t, value, EqualTo{"s3cr3t"})
+	_, ok = conf.Secret("missing")
+	AssertThat(t, ok, Is{false})
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"os"
+	"regexp"
+)
+
+// Matches ${NAME} and ${NAME:-default}
+var envVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// Replaces environment variable references with their values
+func expandEnv(s string) string {
+	return envVariable.ReplaceAllStringFunc(s, func(match string) string {
+		groups := envVariable.FindStringSubmatch(match)
+		value, ok := os.LookupEnv(groups[1])
+		if (!ok || value == "") && groups[2] != "" {
+			return groups[3]
+		}
+		return value
+	})
+}
+
+func expandEnvMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	ret := make(map[string]string)
+	for k, v := range m {
+		ret[expandEnv(k)] = expandEnv(v)
+	}
+	return ret
+}
+
+func (ct Containers) expandEnv() Containers {
+	for containerType, c := range ct {
+		c.Image = expandEnv(c.Image)
+		c.DataDir = expandEnv(c.DataDir)
+		c.Tmpfs = expandEnvMap(c.Tmpfs)
+		c.Templates = expandEnvMap(c.Templates)
+		c.Env = expandEnvMap(c.Env)
+		for i, volume := range c.Volumes {
+			c.Volumes[i] = expandEnv(volume)
+		}
+		ct[containerType] = c
+	}
+	return ct
+}
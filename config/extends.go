@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Replaces every container extending another one with the result of merging them
+func (ct Containers) resolve() (Containers, error) {
+	resolved := make(Containers)
+	for containerType := range ct {
+		c, err := ct.resolveContainer(containerType, nil)
+		if err != nil {
+			return nil, err
+		}
+		resolved[containerType] = c
+	}
+	return resolved, nil
+}
+
+func (ct Containers) resolveContainer(containerType string, chain []string) (Container, error) {
+	for _, t := range chain {
+		if t == containerType {
+			return Container{}, fmt.Errorf("%s: circular extends: %s", chain[0], strings.Join(append(chain, containerType), " -> "))
+		}
+	}
+	c, ok := ct[containerType]
+	if !ok {
+		return Container{}, fmt.Errorf("%s.extends: unknown container type \"%s\"", chain[len(chain)-1], containerType)
+	}
+	if c.Extends != "" {
+		parent, err := ct.resolveContainer(c.Extends, append(chain, containerType))
+		if err != nil {
+			return Container{}, err
+		}
+		c = parent.merge(c)
+	}
+	if c.Tool == "" {
+		c.Tool = containerType
+	}
+	return c, nil
+}
+
+// Returns a copy of container overridden with non-empty child fields
+func (c Container) merge(child Container) Container {
+	ret := c
+	ret.Extends = child.Extends
+	ret.Default = child.Default
+	if child.Tool != "" {
+		ret.Tool = child.Tool
+	}
+	if child.Image != "" {
+		ret.Image = child.Image
+	}
+	if child.DataDir != "" {
+		ret.DataDir = child.DataDir
+	}
+	ret.Tmpfs = mergeMaps(c.Tmpfs, child.Tmpfs)
+	ret.Templates = mergeMaps(c.Templates, child.Templates)
+	ret.Env = mergeMaps(c.Env, child.Env)
+	ret.Volumes = mergeVolumes(c.Volumes, child.Volumes)
+	if child.Limits.Memory != "" {
+		ret.Limits.Memory = child.Limits.Memory
+	}
+	if child.Limits.CPUs != 0 {
+		ret.Limits.CPUs = child.Limits.CPUs
+	}
+	return ret
+}
+
+func mergeMaps(parent, child map[string]string) map[string]string {
+	if parent == nil && child == nil {
+		return nil
+	}
+	ret := make(map[string]string)
+	for k, v := range parent {
+		ret[k] = v
+	}
+	for k, v := range child {
+		ret[k] = v
+	}
+	return ret
+}
+
+// Child volumes replace parent ones mounted to the same destination
+func mergeVolumes(parent, child []string) []string {
+	if parent == nil && child == nil {
+		return nil
+	}
+	ret := []string{}
+	overridden := make(map[string]bool)
+	for _, volume := range child {
+		overridden[volumeDestination(volume)] = true
+	}
+	for _, volume := range parent {
+		if !overridden[volumeDestination(volume)] {
+			ret = append(ret, volume)
+		}
+	}
+	return append(ret, child...)
+}
+
+func volumeDestination(volume string) string {
+	pieces := strings.Split(volume, ":")
+	if len(pieces) < 2 {
+		return volume
+	}
+	return path.Clean(pieces[1])
+}
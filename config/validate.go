@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"github.com/aerokube/rt/common"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	volumeName    = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+	volumeOptions = map[string]bool{
+		"ro": true, "rw": true, "z": true, "Z": true, "nocopy": true,
+		"shared": true, "slave": true, "private": true,
+		"rshared": true, "rslave": true, "rprivate": true,
+		"delegated": true, "cached": true, "consistent": true,
+	}
+)
+
+// Validate checks all containers and returns ValidationError when anything is wrong.
+// Container types are checked against the list of tools unless it is empty.
+func (ct Containers) Validate(tools []string) error {
+	var errs common.ValidationError
+	if len(ct) == 0 {
+		errs = append(errs, "no containers defined")
+	}
+	containerTypes := make([]string, 0, len(ct))
+	for containerType := range ct {
+		containerTypes = append(containerTypes, containerType)
+	}
+	sort.Strings(containerTypes)
+	defaults := make(map[string]string)
+	for _, containerType := range containerTypes {
+		c := ct[containerType]
+		if len(tools) > 0 && !contains(tools, c.Tool) {
+			errs = append(errs, fmt.Sprintf("%s.tool: unsupported tool \"%s\", expected one of: %s", containerType, c.Tool, strings.Join(tools, ", ")))
+		}
+		if c.Default {
+			if other, ok := defaults[c.Tool]; ok {
+				errs = append(errs, fmt.Sprintf("%s.default: container \"%s\" is already default for tool \"%s\"", containerType, other, c.Tool))
+			} else {
+				defaults[c.Tool] = containerType
+			}
+		}
+		errs = append(errs, c.validate(containerType)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// CheckTemplates reads templates of every container from its image with read function
+// and returns ValidationError listing containers whose templates can not be read
+func (ct Containers) CheckTemplates(read func(image string, paths []string) (map[string]string, error)) error {
+	var errs common.ValidationError
+	containerTypes := make([]string, 0, len(ct))
+	for containerType := range ct {
+		containerTypes = append(containerTypes, containerType)
+	}
+	sort.Strings(containerTypes)
+	for _, containerType := range containerTypes {
+		c := ct[containerType]
+		var paths []string
+		for tpl := range c.Templates {
+			paths = append(paths, tpl)
+		}
+		if len(paths) == 0 {
+			continue
+		}
+		sort.Strings(paths)
+		if _, err := read(c.Image, paths); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.templates: %v", containerType, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c Container) validate(prefix string) []string {
+	var errs []string
+	fail := func(field string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf("%s.%s: %s", prefix, field, fmt.Sprintf(format, args...)))
+	}
+	if strings.TrimSpace(c.Image) == "" {
+		fail("image", "must not be empty")
+	}
+	if c.DataDir == "" {
+		fail("dataDir", "must not be empty")
+	} else if !path.IsAbs(c.DataDir) {
+		fail("dataDir", "must be an absolute path, got \"%s\"", c.DataDir)
+	}
+	for mountPoint := range c.Tmpfs {
+		if !path.IsAbs(mountPoint) {
+			fail("tmpfs", "mount point must be an absolute path, got \"%s\"", mountPoint)
+		}
+	}
+	for tpl, output := range c.Templates {
+		if !path.IsAbs(tpl) {
+			fail("templates", "template must be an absolute path inside the image, got \"%s\"", tpl)
+		}
+		if !path.IsAbs(output) {
+			fail("templates", "output file for \"%s\" must be an absolute path, got \"%s\"", tpl, output)
+		}
+	}
+	for i, volume := range c.Volumes {
+		if err := validateVolume(volume); err != nil {
+			fail(fmt.Sprintf("volumes[%d]", i), "%v", err)
+		}
+	}
+	for name := range c.Env {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			fail("env", "invalid variable name \"%s\"", name)
+		}
+	}
+	if _, err := c.Limits.MemoryBytes(); err != nil {
+		fail("limits.memory", "%v", err)
+	}
+	if c.Limits.CPUs < 0 {
+		fail("limits.cpus", "must not be negative, got %v", c.Limits.CPUs)
+	}
+	return errs
+}
+
+// Checks volume in Docker format: <host path or volume name>:<container path>[:<options>]
+func validateVolume(volume string) error {
+	pieces := strings.Split(volume, ":")
+	if len(pieces) < 2 || len(pieces) > 3 {
+		return fmt.Errorf("expected \"<source>:<destination>[:<options>]\", got \"%s\"", volume)
+	}
+	source, destination := pieces[0], pieces[1]
+	if !path.IsAbs(source) && !volumeName.MatchString(source) {
+		return fmt.Errorf("source must be an absolute path or a volume name, got \"%s\"", source)
+	}
+	if !path.IsAbs(destination) {
+		return fmt.Errorf("destination must be an absolute path, got \"%s\"", destination)
+	}
+	if len(pieces) == 3 {
+		for _, option := range strings.Split(pieces[2], ",") {
+			if !volumeOptions[option] {
+				return fmt.Errorf("unknown option \"%s\"", option)
+			}
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
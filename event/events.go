@@ -1,21 +1,78 @@
 package event
 
+import "sync"
+
+// Events not read by slow subscribers are dropped when buffer is full
+const subscriberBuffer = 256
+
 type EventBus struct {
-	events chan Event
+	events      chan Event
+	lock        sync.RWMutex
+	listeners   []func(Event)
+	subscribers map[chan Event]struct{}
 }
 
 func NewEventBus() *EventBus {
-	return &EventBus{events: make(chan Event)}
+	return &EventBus{
+		events:      make(chan Event, subscriberBuffer),
+		subscribers: make(map[chan Event]struct{}),
+	}
 }
 
 func (eb *EventBus) Events() <-chan Event {
 	return eb.events
 }
 
+// AddListener registers function called synchronously for every fired event
+func (eb *EventBus) AddListener(fn func(Event)) {
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+	eb.listeners = append(eb.listeners, fn)
+}
+
+// Subscribe returns channel receiving every event fired from now on
+// and function to stop receiving them
+func (eb *EventBus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+	eb.subscribers[ch] = struct{}{}
+	return ch, func() {
+		eb.lock.Lock()
+		defer eb.lock.Unlock()
+		if _, ok := eb.subscribers[ch]; ok {
+			delete(eb.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
 func (eb *EventBus) Fire(eventType string, id string) {
-	go func() {
-		eb.events <- Event{Type: eventType, Id: id}
-	}()
+	eb.fire(Event{Type: eventType, Id: id})
+}
+
+// FireTestCase fires test case event also telling which launch test case belongs to
+func (eb *EventBus) FireTestCase(eventType string, launchId string, testCaseId string) {
+	eb.fire(Event{Type: eventType, Id: testCaseId, LaunchId: launchId})
+}
+
+func (eb *EventBus) fire(evt Event) {
+	eb.lock.RLock()
+	defer eb.lock.RUnlock()
+	for _, fn := range eb.listeners {
+		fn(evt)
+	}
+	for ch := range eb.subscribers {
+		send(ch, evt)
+	}
+	send(eb.events, evt)
+}
+
+func send(ch chan Event, evt Event) {
+	select {
+	case ch <- evt:
+	default:
+	}
 }
 
 // Events
@@ -28,9 +85,34 @@ const (
 	TestCaseFailed     = "test_case_failed"
 	TestCaseRevoked    = "test_case_revoked"
 	TestCaseTimedOut   = "test_case_timed_out"
+	ConfigReloaded     = "config_reloaded"
 )
 
+var types = []string{
+	LaunchStarted, LaunchFinished, TestCaseStarted, TestCaseNotStarted, TestCasePassed,
+	TestCaseFailed, TestCaseRevoked, TestCaseTimedOut, ConfigReloaded,
+}
+
+// IsKnown tells whether event type exists
+func IsKnown(eventType string) bool {
+	for _, t := range types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
 type Event struct {
-	Type string
-	Id   string // Test case ID or launch ID
+	Type     string
+	Id       string // Test case ID or launch ID, empty for configuration events
+	LaunchId string `json:",omitempty"` // Set for test case events
+}
+
+// Launch returns ID of launch event belongs to, empty for configuration events
+func (e Event) Launch() string {
+	if e.Type == LaunchStarted || e.Type == LaunchFinished {
+		return e.Id
+	}
+	return e.LaunchId
 }
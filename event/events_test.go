@@ -16,3 +16,42 @@ func TestFireAndConsume(t *testing.T) {
 		},
 	})
 }
+
+func TestListener(t *testing.T) {
+	eventBus := NewEventBus()
+	var received []Event
+	eventBus.AddListener(func(evt Event) {
+		received = append(received, evt)
+	})
+	eventBus.FireTestCase(TestCaseStarted, "launch-id", "test-case-id")
+	AssertThat(t, received, EqualTo{[]Event{{Type: TestCaseStarted, Id: "test-case-id", LaunchId: "launch-id"}}})
+	AssertThat(t, <-eventBus.Events(), EqualTo{received[0]})
+}
+
+func TestIsKnown(t *testing.T) {
+	AssertThat(t, IsKnown(TestCaseFailed), Is{true})
+	AssertThat(t, IsKnown("test_case_exploded"), Is{false})
+}
+
+func TestLaunch(t *testing.T) {
+	AssertThat(t, Event{Type: LaunchFinished, Id: "launch-id"}.Launch(), EqualTo{"launch-id"})
+	AssertThat(t, Event{Type: TestCaseFailed, Id: "test-case-id", LaunchId: "launch-id"}.Launch(), EqualTo{"launch-id"})
+	AssertThat(t, Event{Type: ConfigReloaded}.Launch(), EqualTo{""})
+}
+
+func TestSubscribe(t *testing.T) {
+	eventBus := NewEventBus()
+	first, unsubscribeFirst := eventBus.Subscribe()
+	second, unsubscribeSecond := eventBus.Subscribe()
+	defer unsubscribeSecond()
+	eventBus.Fire(LaunchStarted, "launch-id")
+	AssertThat(t, <-first, EqualTo{Event{Type: LaunchStarted, Id: "launch-id"}})
+	AssertThat(t, <-second, EqualTo{Event{Type: LaunchStarted, Id: "launch-id"}})
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	eventBus.Fire(LaunchFinished, "launch-id")
+	_, open := <-first
+	AssertThat(t, open, Is{false})
+	AssertThat(t, <-second, EqualTo{Event{Type: LaunchFinished, Id: "launch-id"}})
+}
@@ -0,0 +1,255 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aerokube/rt/common"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if n == strings.ToLower(name) {
+			return Level(i), nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("unknown log level: %s", name)
+}
+
+// Output formats
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+// Stable field names
+const (
+	requestIdField     = "request_id"
+	launchIdField      = "launch_id"
+	testCaseIdField    = "test_case_id"
+	containerIdField   = "container_id"
+	containerTypeField = "container_type"
+	imageField         = "image"
+	durationField      = "duration"
+	errorField         = "error"
+)
+
+var (
+	lock     sync.Mutex
+	output   io.Writer = os.Stderr
+	format             = TextFormat
+	minLevel           = InfoLevel
+	now                = time.Now
+)
+
+// Configure sets output format (text or json) and minimum level of logged entries
+func Configure(logFormat string, level Level) error {
+	if logFormat != TextFormat && logFormat != JSONFormat {
+		return fmt.Errorf("unknown log format: %s", logFormat)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	format, minLevel = logFormat, level
+	return nil
+}
+
+func SetOutput(w io.Writer) {
+	lock.Lock()
+	defer lock.Unlock()
+	output = w
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// Entry is a set of fields to log with an event. Entries are never modified
+// so an entry with common fields can be shared and extended.
+type Entry struct {
+	fields []field
+}
+
+func (e *Entry) With(key string, value interface{}) *Entry {
+	ret := &Entry{fields: make([]field, len(e.fields), len(e.fields)+1)}
+	copy(ret.fields, e.fields)
+	ret.fields = append(ret.fields, field{key, value})
+	return ret
+}
+
+func (e *Entry) Request(requestId common.RequestId) *Entry {
+	return e.With(requestIdField, requestId)
+}
+
+func (e *Entry) Launch(launchId string) *Entry {
+	return e.With(launchIdField, launchId)
+}
+
+func (e *Entry) TestCase(testCaseId string) *Entry {
+	return e.With(testCaseIdField, testCaseId)
+}
+
+func (e *Entry) Container(containerId string) *Entry {
+	return e.With(containerIdField, containerId)
+}
+
+func (e *Entry) ContainerType(containerType string) *Entry {
+	return e.With(containerTypeField, containerType)
+}
+
+func (e *Entry) Image(image string) *Entry {
+	return e.With(imageField, image)
+}
+
+// Duration is logged in seconds
+func (e *Entry) Duration(d time.Duration) *Entry {
+	return e.With(durationField, float64(d/time.Millisecond)/1000)
+}
+
+func (e *Entry) Err(err error) *Entry {
+	if err == nil {
+		return e
+	}
+	return e.With(errorField, strings.TrimSpace(err.Error()))
+}
+
+func (e *Entry) Debug(event string) {
+	e.log(DebugLevel, event)
+}
+
+func (e *Entry) Info(event string) {
+	e.log(InfoLevel, event)
+}
+
+func (e *Entry) Warn(event string) {
+	e.log(WarnLevel, event)
+}
+
+func (e *Entry) Error(event string) {
+	e.log(ErrorLevel, event)
+}
+
+// Fatal logs an error and exits
+func (e *Entry) Fatal(event string) {
+	e.log(ErrorLevel, event)
+	os.Exit(1)
+}
+
+func (e *Entry) log(level Level, event string) {
+	lock.Lock()
+	defer lock.Unlock()
+	if level < minLevel {
+		return
+	}
+	var buf bytes.Buffer
+	if format == JSONFormat {
+		e.writeJSON(&buf, level, event)
+	} else {
+		e.writeText(&buf, level, event)
+	}
+	output.Write(buf.Bytes())
+}
+
+func (e *Entry) writeJSON(buf *bytes.Buffer, level Level, event string) {
+	fmt.Fprintf(buf, `{"time":"%s","level":"%s","event":%s`, now().Format(time.RFC3339Nano), level, jsonValue(event))
+	for _, f := range e.fields {
+		fmt.Fprintf(buf, `,%s:%s`, jsonValue(f.key), jsonValue(f.value))
+	}
+	buf.WriteString("}\n")
+}
+
+func jsonValue(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return data
+}
+
+func (e *Entry) writeText(buf *bytes.Buffer, level Level, event string) {
+	fmt.Fprintf(buf, "%s %-5s %s", now().Format("2006-01-02T15:04:05.000Z07:00"), strings.ToUpper(level.String()), event)
+	for _, f := range e.fields {
+		fmt.Fprintf(buf, " %s=%s", f.key, textValue(f.value))
+	}
+	buf.WriteString("\n")
+}
+
+func textValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+var empty = &Entry{}
+
+func With(key string, value interface{}) *Entry {
+	return empty.With(key, value)
+}
+
+func Request(requestId common.RequestId) *Entry {
+	return empty.Request(requestId)
+}
+
+func Launch(launchId string) *Entry {
+	return empty.Launch(launchId)
+}
+
+func Err(err error) *Entry {
+	return empty.Err(err)
+}
+
+func Debug(event string) {
+	empty.Debug(event)
+}
+
+func Info(event string) {
+	empty.Info(event)
+}
+
+func Warn(event string) {
+	empty.Warn(event)
+}
+
+func Error(event string) {
+	empty.Error(event)
+}
+
+// Writer returns writer logging every line as message field of given event,
+// used to capture standard library log output
+func Writer(event string) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+			With("message", line).Warn(event)
+		}
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
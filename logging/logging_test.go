@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+)
+
+func capture(logFormat string, level Level, fn func()) string {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	Configure(logFormat, level)
+	now = func() time.Time { return time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC) }
+	defer func() {
+		SetOutput(os.Stderr)
+		Configure(TextFormat, InfoLevel)
+		now = time.Now
+	}()
+	fn()
+	return buf.String()
+}
+
+func TestText(t *testing.T) {
+	out := capture(TextFormat, InfoLevel, func() {
+		Request(42).Launch("launch-1").TestCase("test case").Duration(1500 * time.Millisecond).Info("LAUNCHED")
+	})
+	AssertThat(t, out, EqualTo{"2017-05-01T10:00:00.000Z INFO  LAUNCHED request_id=42 launch_id=launch-1 test_case_id=\"test case\" duration=1.5\n"})
+}
+
+func TestJSON(t *testing.T) {
+	out := capture(JSONFormat, InfoLevel, func() {
+		Request(42).Container("abc").Err(errors.New("failed\n")).Error("FAILED_TO_REMOVE_CONTAINER")
+	})
+	AssertThat(t, out, EqualTo{`{"time":"2017-05-01T10:00:00Z","level":"error","event":"FAILED_TO_REMOVE_CONTAINER","request_id":42,"container_id":"abc","error":"failed"}` + "\n"})
+	var entry map[string]interface{}
+	AssertThat(t, json.Unmarshal([]byte(out), &entry), Is{nil})
+}
+
+func TestLevel(t *testing.T) {
+	out := capture(TextFormat, WarnLevel, func() {
+		Info("SKIPPED")
+		Debug("SKIPPED")
+	})
+	AssertThat(t, out, EqualTo{""})
+}
+
+func TestEntryIsNotModified(t *testing.T) {
+	base := Request(1)
+	out := capture(TextFormat, InfoLevel, func() {
+		base.Launch("a").Info("FIRST")
+		base.Launch("b").Info("SECOND")
+	})
+	AssertThat(t, out, EqualTo{"2017-05-01T10:00:00.000Z INFO  FIRST request_id=1 launch_id=a\n2017-05-01T10:00:00.000Z INFO  SECOND request_id=1 launch_id=b\n"})
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("WARN")
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, level, EqualTo{WarnLevel})
+	_, err = ParseLevel("verbose")
+	AssertThat(t, err, Is{Not{nil}})
+}
+
+func TestUnknownFormat(t *testing.T) {
+	AssertThat(t, Configure("xml", InfoLevel), Is{Not{nil}})
+}
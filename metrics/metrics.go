@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// All metrics created by this package are registered here
+var Default = &Registry{}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+// Set of metrics written in Prometheus text exposition format
+type Registry struct {
+	lock       sync.RWMutex
+	collectors []collector
+}
+
+func (r *Registry) register(c collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) Write(w io.Writer) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	bw := bufio.NewWriter(w)
+	for _, c := range r.collectors {
+		c.write(bw)
+	}
+	bw.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.Write(w)
+}
+
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d *desc) header(w io.Writer, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, metricType)
+}
+
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// Formats labels like {a="1",b="2"} including extra label pairs
+func (d *desc) labelString(key string, extra ...string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, d.labels[i], escape(value)))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escape(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Counter or gauge with optional labels
+type value struct {
+	desc
+	metricType string
+	lock       sync.RWMutex
+	values     map[string]float64
+}
+
+func (v *value) add(delta float64, labelValues []string) {
+	key := v.key(labelValues)
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.values[key] += delta
+}
+
+// Value returns current value for label values
+func (v *value) Value(labelValues ...string) float64 {
+	key := v.key(labelValues)
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.values[key]
+}
+
+func (v *value) write(w io.Writer) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	v.header(w, v.metricType)
+	for _, key := range sortedKeys(v.values) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelString(key), formatFloat(v.values[key]))
+	}
+}
+
+// Monotonically increasing value
+type Counter struct {
+	value
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{value{desc: desc{name, help, labels}, metricType: "counter", values: make(map[string]float64)}}
+	if len(labels) == 0 {
+		c.values[""] = 0
+	}
+	Default.register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter %s can not decrease", c.name))
+	}
+	c.add(delta, labelValues)
+}
+
+// Value that can go up and down
+type Gauge struct {
+	value
+}
+
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{value{desc: desc{name, help, labels}, metricType: "gauge", values: make(map[string]float64)}}
+	if len(labels) == 0 {
+		g.values[""] = 0
+	}
+	Default.register(g)
+	return g
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.add(1, labelValues)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.add(-1, labelValues)
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.values[key] = v
+}
+
+// Counter or gauge read from a function on every scrape
+type Func struct {
+	desc
+	metricType string
+	fn         func() float64
+}
+
+func NewGaugeFunc(name string, help string, fn func() float64) *Func {
+	f := &Func{desc: desc{name: name, help: help}, metricType: "gauge", fn: fn}
+	Default.register(f)
+	return f
+}
+
+func NewCounterFunc(name string, help string, fn func() float64) *Func {
+	f := &Func{desc: desc{name: name, help: help}, metricType: "counter", fn: fn}
+	Default.register(f)
+	return f
+}
+
+func (f *Func) write(w io.Writer) {
+	f.header(w, f.metricType)
+	fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+}
+
+// Default histogram buckets in seconds
+var DurationBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 900, 1800, 3600, 7200}
+
+type histogramValue struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Distribution of observed values
+type Histogram struct {
+	desc
+	buckets []float64
+	lock    sync.RWMutex
+	values  map[string]*histogramValue
+}
+
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{desc: desc{name, help, labels}, buckets: buckets, values: make(map[string]*histogramValue)}
+	Default.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			hv.counts[i]++
+		}
+	}
+	hv.sum += v
+	hv.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	h.header(w, "histogram")
+	var keys []string
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		hv := h.values[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(key, "le", formatFloat(bound)), hv.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(key, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(key), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(key), hv.count)
+	}
+}
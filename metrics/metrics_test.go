@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/aandryashin/matchers"
+)
+
+func scrape() string {
+	var buf bytes.Buffer
+	Default.Write(&buf)
+	return buf.String()
+}
+
+func TestCounter(t *testing.T) {
+	c := NewCounter("test_counter_total", "Test counter.", "type", "outcome")
+	c.Inc("maven", "passed")
+	c.Inc("maven", "passed")
+	c.Add(3, "maven", "failed")
+
+	out := scrape()
+	AssertThat(t, strings.Contains(out, "# HELP test_counter_total Test counter.\n# TYPE test_counter_total counter\n"), Is{true})
+	AssertThat(t, strings.Contains(out, `test_counter_total{type="maven",outcome="failed"} 3`+"\n"), Is{true})
+	AssertThat(t, strings.Contains(out, `test_counter_total{type="maven",outcome="passed"} 2`+"\n"), Is{true})
+}
+
+func TestGauge(t *testing.T) {
+	g := NewGauge("test_gauge", "Test gauge.")
+	AssertThat(t, strings.Contains(scrape(), "test_gauge 0\n"), Is{true})
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	AssertThat(t, strings.Contains(scrape(), "test_gauge 1\n"), Is{true})
+	g.Set(2.5)
+	AssertThat(t, strings.Contains(scrape(), "test_gauge 2.5\n"), Is{true})
+	AssertThat(t, g.Value(), EqualTo{2.5})
+}
+
+func TestFunc(t *testing.T) {
+	NewCounterFunc("test_func_total", "Test function.", func() float64 { return 42 })
+	out := scrape()
+	AssertThat(t, strings.Contains(out, "# TYPE test_func_total counter\ntest_func_total 42\n"), Is{true})
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "Test histogram.", []float64{1, 5}, "type")
+	h.Observe(0.5, "maven")
+	h.Observe(3, "maven")
+	h.Observe(10, "maven")
+
+	out := scrape()
+	AssertThat(t, strings.Contains(out, "# TYPE test_duration_seconds histogram\n"), Is{true})
+	AssertThat(t, strings.Contains(out, `test_duration_seconds_bucket{type="maven",le="1"} 1`+"\n"), Is{true})
+	AssertThat(t, strings.Contains(out, `test_duration_seconds_bucket{type="maven",le="5"} 2`+"\n"), Is{true})
+	AssertThat(t, strings.Contains(out, `test_duration_seconds_bucket{type="maven",le="+Inf"} 3`+"\n"), Is{true})
+	AssertThat(t, strings.Contains(out, `test_duration_seconds_sum{type="maven"} 13.5`+"\n"), Is{true})
+	AssertThat(t, strings.Contains(out, `test_duration_seconds_count{type="maven"} 3`+"\n"), Is{true})
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	AssertThat(t, escape("a\"b\\c\nd"), EqualTo{`a\"b\\c\nd`})
+}
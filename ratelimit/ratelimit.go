@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Buckets not used for this long are forgotten when they are full again
+const sweepInterval = time.Minute
+
+// Limiter keeps a token bucket per key, e.g. per API token or client IP
+type Limiter struct {
+	Rate  float64 // Tokens added per second, zero disables limiting
+	Burst int     // Bucket capacity
+
+	lock    sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func New(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{Rate: rate, Burst: burst, buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow takes a token from bucket of key or returns how long to wait for the next one
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.Rate <= 0 {
+		return true, 0
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), updated: now}
+		l.buckets[key] = b
+	}
+	b.refill(now, l.Rate, l.Burst)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+}
+
+func (b *bucket) refill(now time.Time, rate float64, burst int) {
+	b.tokens += now.Sub(b.updated).Seconds() * rate
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.updated = now
+}
+
+// Removes buckets that became full, they are equal to new ones
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		b.refill(now, l.Rate, l.Burst)
+		if b.tokens >= float64(l.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
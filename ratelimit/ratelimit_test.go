@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func TestAllow(t *testing.T) {
+	c := &clock{time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)}
+	l := New(0.5, 2)
+	l.now = c.now
+
+	ok, _ := l.Allow("team-a")
+	AssertThat(t, ok, Is{true})
+	ok, _ = l.Allow("team-a")
+	AssertThat(t, ok, Is{true})
+	ok, retryAfter := l.Allow("team-a")
+	AssertThat(t, ok, Is{false})
+	AssertThat(t, retryAfter, EqualTo{2 * time.Second})
+
+	ok, _ = l.Allow("team-b")
+	AssertThat(t, ok, Is{true})
+
+	c.t = c.t.Add(time.Second)
+	ok, retryAfter = l.Allow("team-a")
+	AssertThat(t, ok, Is{false})
+	AssertThat(t, retryAfter, EqualTo{time.Second})
+
+	c.t = c.t.Add(time.Second)
+	ok, _ = l.Allow("team-a")
+	AssertThat(t, ok, Is{true})
+}
+
+func TestSweep(t *testing.T) {
+	c := &clock{time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)}
+	l := New(1, 5)
+	l.now = c.now
+	l.Allow("team-a")
+	l.Allow("team-b")
+	AssertThat(t, len(l.buckets), EqualTo{2})
+
+	c.t = c.t.Add(2 * sweepInterval)
+	l.Allow("team-c")
+	AssertThat(t, len(l.buckets), EqualTo{1})
+}
+
+func TestDisabled(t *testing.T) {
+	var l *Limiter
+	ok, _ := l.Allow("team-a")
+	AssertThat(t, ok, Is{true})
+	l = New(0, 1)
+	for i := 0; i < 10; i++ {
+		ok, _ = l.Allow("team-a")
+		AssertThat(t, ok, Is{true})
+	}
+}
@@ -1,13 +1,25 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"github.com/aerokube/rt/api"
+	"github.com/aerokube/rt/auth"
+	"github.com/aerokube/rt/certs"
 	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/s3"
+	"github.com/aerokube/rt/service"
+	"github.com/aerokube/rt/store"
+	"github.com/aerokube/rt/tracing"
+	"github.com/docker/go-units"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -19,6 +31,41 @@ var (
 	dataDir         string
 	timeout         time.Duration
 	shutdownTimeout time.Duration
+	stopTimeout     time.Duration
+	validateConfig  bool
+	historyPath     string
+	instanceId      string
+	recoveryPolicy  string
+	gcInterval      time.Duration
+	gcGrace         time.Duration
+	retention       config.Retention
+	retentionSize   string
+	launchLimits    config.LaunchLimits
+	maxLaunchSize   string
+	rateLimits      config.RateLimits
+	minFreeDisk     string
+	version         bool
+	s3Config        s3.Config
+	logFormat       string
+	logLevel        string
+	otlpEndpoint    string
+	serviceName     string
+	webhooksPath    string
+	deadLetterPath  string
+	webhookUrls     string
+	webhookAttempts int
+	tokensPath      string
+	hashToken       string
+	secretsPath     string
+	secretsDir      string
+	tlsCert         string
+	tlsKey          string
+	tlsClientCA     string
+
+	flushTimeout = 10 * time.Second // Time to deliver webhooks and traces after drain
+
+	gitRevision = "HEAD"    // Set with -ldflags "-X main.gitRevision=..."
+	buildStamp  = "unknown" // Set with -ldflags "-X main.buildStamp=..."
 )
 
 func init() {
@@ -28,32 +75,253 @@ func init() {
 	flag.StringVar(&dataDir, "data-dir", "data", "directory to save results to")
 	flag.DurationVar(&timeout, "timeout", 2*time.Hour, "test case timeout")
 	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 5*time.Minute, "time to wait for test cases to finish on shutdown")
+	flag.DurationVar(&stopTimeout, "stop-timeout", 10*time.Second, "time terminated container gets to exit before it is killed")
+	flag.StringVar(&historyPath, "history", "", "launch history database file (default <data-dir>/history.db)")
+	flag.StringVar(&instanceId, "instance-id", hostname(), "rt instance ID used to find containers left after restart")
+	flag.StringVar(&recoveryPolicy, "recovery", api.ReattachPolicy, "what to do with containers left after restart: reattach or remove")
+	flag.DurationVar(&gcInterval, "gc-interval", 5*time.Minute, "how often to remove orphaned containers, 0 to disable")
+	flag.DurationVar(&gcGrace, "gc-grace", 5*time.Minute, "extra time before container is considered orphaned or timed out")
+	flag.DurationVar(&retention.Interval, "retention-interval", time.Hour, "how often to remove old results from data directory, 0 to disable")
+	flag.DurationVar(&retention.MaxAge, "retention-max-age", 0, "remove launch results older than this, 0 for no limit")
+	flag.StringVar(&retentionSize, "retention-max-size", "", "remove oldest launch results when data directory is bigger, e.g. 50g")
+	flag.IntVar(&retention.KeepLast, "retention-keep-last", 0, "number of most recent launch results to keep, 0 for no limit")
+	flag.StringVar(&maxLaunchSize, "max-launch-size", "10m", "maximum launch request body size, 0 for no limit")
+	flag.IntVar(&launchLimits.MaxTestCases, "max-test-cases", config.DefaultLaunchLimits.MaxTestCases, "maximum number of test cases in one launch, 0 for no limit")
+	flag.IntVar(&launchLimits.MaxValueLength, "max-value-length", config.DefaultLaunchLimits.MaxValueLength, "maximum length of test case names, tags and property values, 0 for no limit")
+	flag.Float64Var(&rateLimits.Rate, "rate-limit", 0, "launch and terminate requests per second allowed for every API token or client IP, 0 for no limit")
+	flag.IntVar(&rateLimits.Burst, "rate-burst", 10, "requests allowed at once before -rate-limit applies")
+	flag.IntVar(&rateLimits.MaxActiveTestCases, "max-active-test-cases", 0, "maximum queued and running test cases per API token or client IP, 0 for no limit")
+	flag.StringVar(&minFreeDisk, "min-free-disk", "1g", "free space in data directory required to be ready, 0 to disable the check")
+	flag.BoolVar(&version, "version", false, "show version and exit")
+	flag.StringVar(&s3Config.Endpoint, "s3-endpoint", "", "S3-compatible storage URL to upload results to, e.g. http://minio:9000")
+	flag.StringVar(&s3Config.Region, "s3-region", "us-east-1", "S3 region")
+	flag.StringVar(&s3Config.Bucket, "s3-bucket", "", "S3 bucket to upload results to")
+	flag.StringVar(&s3Config.AccessKey, "s3-access-key", os.Getenv("AWS_ACCESS_KEY_ID"), "S3 access key")
+	flag.StringVar(&s3Config.SecretKey, "s3-secret-key", os.Getenv("AWS_SECRET_ACCESS_KEY"), "S3 secret key")
+	flag.BoolVar(&s3Config.DeleteLocal, "s3-delete-local", false, "remove results from data directory after upload")
+	flag.StringVar(&logFormat, "log-format", logging.TextFormat, "log format: text or json")
+	flag.StringVar(&logLevel, "log-level", "info", "minimum log level: debug, info, warn or error")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP collector to export traces to, e.g. http://localhost:4318")
+	flag.StringVar(&serviceName, "otlp-service-name", "rt", "service name reported in exported traces")
+	flag.StringVar(&webhooksPath, "webhooks", "", "global webhooks configuration file")
+	flag.StringVar(&deadLetterPath, "webhook-dead-letter", "", "file to save failed webhook deliveries to (default <data-dir>/webhooks-dead-letter.log)")
+	flag.StringVar(&webhookUrls, "launch-webhook-urls", "", "comma-separated URL prefixes launch webhooks are allowed to post to, launch webhooks are refused when empty")
+	flag.IntVar(&webhookAttempts, "webhook-attempts", 5, "how many times to try delivering webhook payload")
+	flag.StringVar(&tokensPath, "auth-tokens", "", "API tokens file, authentication is disabled when not set")
+	flag.StringVar(&secretsPath, "secrets", "", "named secrets file launch properties can reference")
+	flag.StringVar(&secretsDir, "secrets-dir", filepath.Join(os.TempDir(), "rt-secrets"), "host directory to store secret properties files mounted to containers in")
+	flag.StringVar(&hashToken, "hash-token", "", "print hash of token to put to tokens file and exit")
+	flag.StringVar(&tlsCert, "tls-cert", "", "PEM certificate file to serve HTTPS with")
+	flag.StringVar(&tlsKey, "tls-key", "", "PEM private key file for -tls-cert")
+	flag.StringVar(&tlsClientCA, "tls-client-ca", "", "PEM CA bundle to verify client certificates with, they are required for all paths except health checks, /ping and /metrics")
+	flag.BoolVar(&validateConfig, "validate-config", false, "validate configuration files and exit")
 	flag.Parse()
 }
 
-func cancelOnSignal(exit chan bool) {
-	sig := make(chan os.Signal)
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "rt"
+	}
+	return name
+}
+
+// Refuses new launches and drains running ones on first signal,
+// second signal exits at once
+func drainOnSignal(conf *config.Config, server *http.Server, exit chan bool, drained chan bool) {
+	sig := make(chan os.Signal, 2)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sig
 		close(exit)
-		os.Exit(0)
+		go func() {
+			<-sig
+			logging.Warn("FORCED_EXIT")
+			os.Exit(1)
+		}()
+		api.Drain(conf)
+		close(drained)
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		err := server.Shutdown(ctx)
+		if err != nil {
+			logging.Err(err).Warn("FAILED_TO_CLOSE_CONNECTIONS")
+		}
+	}()
+}
+
+func reloadOnSignal(conf *config.Config, loader *certs.Loader) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		for range sig {
+			api.ReloadConfig(conf)
+			if loader == nil {
+				continue
+			}
+			err := loader.Reload()
+			if err != nil {
+				logging.Err(err).Error("FAILED_TO_RELOAD_CERTIFICATES")
+				continue
+			}
+			logging.With("cert", loader.CertFile).Info("CERTIFICATES_RELOADED")
+		}
 	}()
 }
 
 func main() {
-	conf := config.NewConfig(dataDir, timeout, shutdownTimeout)
-	err := conf.Load(confPath, logConfPath)
+	if version {
+		fmt.Printf("Git Revision: %s\n", gitRevision)
+		fmt.Printf("Build Time: %s\n", buildStamp)
+		return
+	}
+	if hashToken != "" {
+		fmt.Println(auth.Hash(hashToken))
+		return
+	}
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		log.Fatalf("%s: %v", os.Args[0], err)
+	}
+	err = logging.Configure(logFormat, level)
 	if err != nil {
 		log.Fatalf("%s: %v", os.Args[0], err)
 	}
-	exit := make(chan bool)
-	cancelOnSignal(exit)
-	go api.ConsumeLaunches(conf, exit)
-	go api.ConsumeTerminates(exit)
-	log.Printf("Listening on %s\n", listen)
-	log.Printf("Saving results to %s\n", dataDir)
-	log.Printf("Test case timeout is %s\n", timeout)
-	log.Printf("Shutdown timeout is %s\n", shutdownTimeout)
-	log.Fatal(http.ListenAndServe(listen, api.Mux(exit)))
+	log.SetFlags(0)
+	log.SetOutput(logging.Writer("GO_LOG"))
+	conf := config.NewConfig(dataDir, timeout, shutdownTimeout)
+	conf.StopTimeout = stopTimeout
+	conf.Tools = api.SupportedTools()
+	conf.InstanceId = instanceId
+	conf.SecretsDir = secretsDir
+	conf.ClientCerts = tlsClientCA != ""
+	for _, prefix := range strings.Split(webhookUrls, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			conf.WebhookUrls = append(conf.WebhookUrls, prefix)
+		}
+	}
+	if recoveryPolicy != api.ReattachPolicy && recoveryPolicy != api.RemovePolicy {
+		logging.With("policy", recoveryPolicy).Fatal("UNKNOWN_RECOVERY_POLICY")
+	}
+	conf.RecoveryPolicy = recoveryPolicy
+	conf.GCInterval, conf.GCGrace = gcInterval, gcGrace
+	if retentionSize != "" {
+		size, err := units.RAMInBytes(retentionSize)
+		if err != nil {
+			logging.Err(err).Fatal("INVALID_RETENTION_SIZE")
+		}
+		retention.MaxSize = size
+	}
+	conf.Retention = retention
+	launchLimits.MaxBodySize, err = units.RAMInBytes(maxLaunchSize)
+	if err != nil {
+		logging.Err(err).Fatal("INVALID_MAX_LAUNCH_SIZE")
+	}
+	conf.LaunchLimits = launchLimits
+	conf.RateLimits = rateLimits
+	conf.MinFreeDisk, err = units.RAMInBytes(minFreeDisk)
+	if err != nil {
+		logging.Err(err).Fatal("INVALID_MIN_FREE_DISK")
+	}
+	api.Version = gitRevision
+	err = conf.Load(confPath, logConfPath)
+	if err != nil {
+		logging.Err(err).Fatal("INVALID_CONFIG")
+	}
+	if webhooksPath != "" {
+		err = conf.LoadWebhooks(webhooksPath)
+		if err != nil {
+			logging.Err(err).Fatal("INVALID_CONFIG")
+		}
+	}
+	if tokensPath != "" {
+		err = conf.LoadTokens(tokensPath)
+		if err != nil {
+			logging.Err(err).Fatal("INVALID_CONFIG")
+		}
+	}
+	var loader *certs.Loader
+	if tlsCert != "" || tlsKey != "" || tlsClientCA != "" {
+		loader, err = certs.NewLoader(tlsCert, tlsKey, tlsClientCA)
+		if err != nil {
+			logging.Err(err).Fatal("INVALID_TLS_CONFIG")
+		}
+	}
+	if secretsPath != "" {
+		err = conf.LoadSecrets(secretsPath)
+		if err != nil {
+			logging.Err(err).Fatal("INVALID_CONFIG")
+		}
+	}
+	docker, err := service.NewDocker(conf)
+	if err != nil {
+		logging.Err(err).Fatal("FAILED_TO_CONNECT_TO_DOCKER")
+	}
+	conf.ReadTemplates = docker.ReadTemplates
+	if validateConfig {
+		err = conf.CheckTemplates()
+		if err != nil {
+			logging.Err(err).Fatal("INVALID_CONFIG")
+		}
+		logging.Info("CONFIG_IS_VALID")
+		return
+	}
+	if historyPath == "" {
+		historyPath = filepath.Join(dataDir, "history.db")
+	}
+	err = os.MkdirAll(filepath.Dir(historyPath), 0755)
+	if err != nil {
+		logging.Err(err).Fatal("FAILED_TO_OPEN_HISTORY")
+	}
+	history, err := store.Open(historyPath)
+	if err != nil {
+		logging.Err(err).Fatal("FAILED_TO_OPEN_HISTORY")
+	}
+	defer history.Close()
+	var uploader *s3.Client
+	if s3Config.Endpoint != "" {
+		uploader, err = s3.NewClient(s3Config)
+		if err != nil {
+			logging.Err(err).Fatal("INVALID_S3_CONFIG")
+		}
+		logging.With("url", uploader.ObjectUrl("")).Info("UPLOADING_RESULTS")
+	}
+	if otlpEndpoint != "" {
+		tracing.Configure(otlpEndpoint, serviceName)
+		logging.With("url", otlpEndpoint).Info("EXPORTING_TRACES")
+	}
+	if deadLetterPath == "" {
+		deadLetterPath = filepath.Join(dataDir, "webhooks-dead-letter.log")
+	}
+	conf.StateFiles = []string{historyPath, deadLetterPath}
+	api.ConfigureWebhooks(conf, deadLetterPath, webhookAttempts)
+	exit, drained := make(chan bool), make(chan bool)
+	reloadOnSignal(conf, loader)
+	go api.ConsumeLaunches(conf, docker, history, uploader, exit)
+	go api.ConsumeTerminates(drained)
+	logging.With("listen", listen).
+		With("data_dir", dataDir).
+		With("timeout", timeout.String()).
+		With("shutdown_timeout", shutdownTimeout.String()).
+		With("version", gitRevision).
+		With("history", historyPath).
+		With("tls", loader != nil).
+		With("client_certificates", tlsClientCA != "").
+		Info("STARTED")
+	server := &http.Server{Addr: listen, Handler: api.Mux(conf, docker, history, exit, drained)}
+	drainOnSignal(conf, server, exit, drained)
+	if loader != nil {
+		server.Handler = loader.Handler(server.Handler, api.OpenPaths...)
+		server.TLSConfig = loader.TLSConfig()
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		logging.Err(err).Fatal("FAILED_TO_LISTEN")
+	}
+	<-drained
+	api.FlushWebhooks(flushTimeout)
+	tracing.Flush(flushTimeout)
+	logging.Info("STOPPED")
 }
@@ -0,0 +1,199 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+	dateFormat      = "20060102"
+)
+
+// S3-compatible storage settings
+type Config struct {
+	Endpoint    string // E.g. https://s3.amazonaws.com or http://localhost:9000 for MinIO
+	Region      string
+	Bucket      string
+	AccessKey   string
+	SecretKey   string
+	DeleteLocal bool // Remove uploaded directory from local disk
+}
+
+// Minimal S3 client uploading objects with path-style URLs and signature version 4
+type Client struct {
+	Config   Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewClient(config Config) (*Client, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %s", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket is not set")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	return &Client{
+		Config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+// ObjectUrl returns URL of object with given key
+func (c *Client) ObjectUrl(key string) string {
+	u := *c.endpoint
+	u.Path = path.Join("/", u.Path, c.Config.Bucket, key)
+	return u.String()
+}
+
+// PutFile uploads local file as object with given key and returns its URL
+func (c *Client) PutFile(file string, key string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	objectUrl := c.ObjectUrl(key)
+	req, err := http.NewRequest(http.MethodPut, objectUrl, f)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = fi.Size()
+	contentType := mime.TypeByExtension(filepath.Ext(file))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+	sign(req, c.Config.AccessKey, c.Config.SecretKey, c.Config.Region, unsignedPayload, time.Now())
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload %s: %v", key, err)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return "", fmt.Errorf("failed to upload %s: %s %s", key, rsp.Status, strings.TrimSpace(string(body)))
+	}
+	return objectUrl, nil
+}
+
+// UploadDir uploads every file in directory under given key prefix and returns object URLs
+func (c *Client) UploadDir(dir string, prefix string) ([]string, error) {
+	var urls []string
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		objectUrl, err := c.PutFile(file, path.Join(prefix, filepath.ToSlash(rel)))
+		if err != nil {
+			return err
+		}
+		urls = append(urls, objectUrl)
+		return nil
+	})
+	return urls, err
+}
+
+// Adds AWS signature version 4 authorization header signing host and all request headers
+func sign(req *http.Request, accessKey, secretKey, region, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(amzDateFormat)
+	date := now.Format(dateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		encodePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSha256(canonicalRequest),
+	}, "\n")
+	key := hmacSha256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSha256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+// URI-encodes every path segment as required by signature version 4
+func encodePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		b := p[i]
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || strings.IndexByte("-._~/", b) >= 0 {
+			sb.WriteByte(b)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
+
+func hexSha256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -5,20 +5,43 @@ import (
 	"fmt"
 	. "github.com/aerokube/rt/common"
 	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/logging"
+	"github.com/aerokube/rt/tracing"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
-	"log"
 	"path"
+	"sort"
 	"time"
 	"encoding/json"
 )
 
+// Labels added to every container
+const (
+	InstanceIdLabel    = "rt.instance-id"
+	LaunchIdLabel      = "rt.launch-id"
+	TestCaseIdLabel    = "rt.test-case-id"
+	ContainerTypeLabel = "rt.container-type"
+	DryRunLabel        = "rt.dry-run" // Set instead of test case labels for containers reading templates
+)
+
 type Docker struct {
-	dataDir   string //Data directory on host machine
-	client    *client.Client
-	logConfig *container.LogConfig
+	dataDir string //Data directory on host machine
+	client  *client.Client
+	config  *config.Config
+}
+
+// Container created by this rt instance
+type ManagedContainer struct {
+	Id            string
+	Image         string
+	LaunchId      string
+	TestCaseId    string
+	ContainerType string
+	Created       time.Time
+	Running       bool
 }
 
 func NewDocker(config *config.Config) (*Docker, error) {
@@ -27,63 +50,189 @@ func NewDocker(config *config.Config) (*Docker, error) {
 		return nil, fmt.Errorf("failed to create Docker client: %v\n", err)
 	}
 	return &Docker{
-		dataDir:   config.DataDir,
-		client:    cl,
-		logConfig: config.LogConfig,
+		dataDir: config.DataDir,
+		client:  cl,
+		config:  config,
 	}, nil
 }
 
 func (docker *Docker) StartWithCancel(bs *BuildSettings) (func(), <-chan bool, error) {
 	ctx := context.Background()
-	rawTemplates, err := marshalData(bs.Templates)
+	env, err := docker.containerEnv(bs)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal templates info: %v\n", err)
+		return nil, nil, err
 	}
-	rawBuildData, err := marshalData(bs.BuildData)
+	memory, err := bs.Limits.MemoryBytes()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal build data: %v\n", err)
+		return nil, nil, fmt.Errorf("invalid memory limit: %v\n", err)
 	}
-	env := []string{
-		fmt.Sprintf("TZ=%s", time.Local),
-		fmt.Sprintf("%s=%s", DataDir, bs.DataDir),
-		fmt.Sprintf("%s=%s", Templates, rawTemplates),
-		fmt.Sprintf("%s=%s", BuildData, rawBuildData),
+	volumes := docker.containerVolumes(bs)
+	if len(bs.Secrets) > 0 {
+		err = writeSecrets(docker.secretsFile(bs), bs.Secrets)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-	volumes := []string{fmt.Sprintf("%s:%s", path.Join(docker.dataDir, bs.BuildData.TestCase.Id), bs.DataDir)}
-	volumes = append(volumes, bs.Volumes...)
+	containerCreateTime := time.Now()
+	span := tracing.StartClient("docker.container_create", bs.Span).SetAttribute("image", bs.Image)
 	resp, err := docker.client.ContainerCreate(ctx,
 		&container.Config{
 			Hostname: "localhost",
 			Image:    bs.Image,
 			Env:      env,
 			Cmd:      bs.Command,
+			Labels: map[string]string{
+				InstanceIdLabel:    docker.config.InstanceId,
+				LaunchIdLabel:      bs.LaunchId,
+				TestCaseIdLabel:    bs.BuildData.TestCase.Id,
+				ContainerTypeLabel: bs.ContainerType,
+			},
 		},
 		&container.HostConfig{
 			Binds:      volumes,
-			LogConfig:  *docker.logConfig,
+			LogConfig:  *docker.config.LogConfig(),
 			Tmpfs:      bs.Tmpfs,
 			ShmSize:    268435456,
 			Privileged: true,
+			Resources: container.Resources{
+				Memory:   memory,
+				NanoCPUs: int64(bs.Limits.CPUs * 1e9),
+			},
 		},
 		&network.NetworkingConfig{}, "")
+	span.SetError(err).End()
 	if err != nil {
+		dockerErrors.Inc(createOperation)
+		removeSecrets(docker.secretsFile(bs))
 		return nil, nil, fmt.Errorf("failed to create container: %v", err)
 	}
+	observeSince(containerCreateSeconds, containerCreateTime, bs.ContainerType)
 	containerId := resp.ID
-	requestId := bs.RequestId
-	testCaseId := bs.BuildData.TestCase.Id
-	image := bs.Image
+	entry := bs.logEntry().Container(containerId)
 	containerStartTime := time.Now()
-	log.Printf("[%d] [STARTING_CONTAINER] [%s] [%s]\n", requestId, testCaseId, image) 
+	entry.Info("STARTING_CONTAINER")
+	span = tracing.StartClient("docker.container_start", bs.Span).SetAttribute("container.id", containerId)
 	err = docker.client.ContainerStart(ctx, containerId, types.ContainerStartOptions{})
+	span.SetError(err).End()
 	if err != nil {
+		dockerErrors.Inc(startOperation)
 		docker.removeContainer(ctx, containerId, bs)
 		return nil, nil, fmt.Errorf("failed to start container: %v", err)
 	}
-	log.Printf("[%d] [CONTAINER_STARTED] [%s] [%s] [%s] [%.2fs]\n", requestId, testCaseId, image, containerId, float64(time.Since(containerStartTime).Seconds()))
+	observeSince(containerStartSeconds, containerStartTime, bs.ContainerType)
+	entry.Duration(time.Since(containerStartTime)).Info("CONTAINER_STARTED")
 	finished := make(chan bool)
-	go docker.waitFor(ctx, containerId, finished)
-	return func() { docker.removeContainer(ctx, containerId, bs) }, finished, nil
+	go docker.waitFor(ctx, containerId, bs.Span, finished)
+	return func() { docker.stopAndRemove(ctx, containerId, bs) }, finished, nil
+}
+
+// ListContainers returns all containers created by this rt instance including stopped ones
+func (docker *Docker) ListContainers() ([]ManagedContainer, error) {
+	args := filters.NewArgs()
+	args.Add("label", fmt.Sprintf("%s=%s", InstanceIdLabel, docker.config.InstanceId))
+	containers, err := docker.client.ContainerList(context.Background(), types.ContainerListOptions{All: true, Filters: args})
+	if err != nil {
+		dockerErrors.Inc(listOperation)
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+	var ret []ManagedContainer
+	for _, c := range containers {
+		ret = append(ret, ManagedContainer{
+			Id:            c.ID,
+			Image:         c.Image,
+			LaunchId:      c.Labels[LaunchIdLabel],
+			TestCaseId:    c.Labels[TestCaseIdLabel],
+			ContainerType: c.Labels[ContainerTypeLabel],
+			Created:       time.Unix(c.Created, 0),
+			Running:       c.State == "running",
+		})
+	}
+	return ret, nil
+}
+
+// Reattach resumes waiting for container left after restart
+func (docker *Docker) Reattach(mc ManagedContainer) (func(), <-chan bool) {
+	ctx := context.Background()
+	bs := mc.buildSettings()
+	finished := make(chan bool)
+	go docker.waitFor(ctx, mc.Id, bs.Span, finished)
+	return func() { docker.stopAndRemove(ctx, mc.Id, bs) }, finished
+}
+
+// Remove removes container even if it is running
+func (docker *Docker) Remove(mc ManagedContainer) error {
+	return docker.removeContainer(context.Background(), mc.Id, mc.buildSettings())
+}
+
+func (mc ManagedContainer) buildSettings() *BuildSettings {
+	return &BuildSettings{
+		LaunchId:      mc.LaunchId,
+		ContainerType: mc.ContainerType,
+		Image:         mc.Image,
+		BuildData:     StandaloneTestCase{TestCase: TestCase{Id: mc.TestCaseId}},
+	}
+}
+
+// Directory on host machine where results of container left after restart are saved
+func (docker *Docker) ContainerDataDir(mc ManagedContainer) string {
+	return docker.HostDataDir(mc.buildSettings())
+}
+
+// Directory on host machine where test case results are saved
+func (docker *Docker) HostDataDir(bs *BuildSettings) string {
+	return path.Join(docker.dataDir, bs.LaunchId, bs.BuildData.TestCase.Id)
+}
+
+// Environment variables passed to container, secret properties are never included
+func (docker *Docker) containerEnv(bs *BuildSettings) ([]string, error) {
+	rawTemplates, err := marshalData(bs.Templates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal templates info: %v\n", err)
+	}
+	rawBuildData, err := marshalData(bs.BuildData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal build data: %v\n", err)
+	}
+	env := []string{
+		fmt.Sprintf("TZ=%s", time.Local),
+		fmt.Sprintf("%s=%s", DataDir, bs.DataDir),
+		fmt.Sprintf("%s=%s", Templates, rawTemplates),
+		fmt.Sprintf("%s=%s", BuildData, rawBuildData),
+	}
+	if bs.Span != nil {
+		env = append(env,
+			fmt.Sprintf("%s=%s", TraceParent, bs.Span.TraceParent()),
+			fmt.Sprintf("%s=%s", TraceId, bs.Span.TraceId()),
+		)
+	}
+	if len(bs.Secrets) > 0 {
+		env = append(env, fmt.Sprintf("%s=%s", SecretsFile, SecretsMountPath))
+	}
+	return append(env, envList(bs.Env)...), nil
+}
+
+// Volumes mounted to container including results directory and secrets file
+func (docker *Docker) containerVolumes(bs *BuildSettings) []string {
+	volumes := []string{fmt.Sprintf("%s:%s", docker.HostDataDir(bs), bs.DataDir)}
+	volumes = append(volumes, bs.Volumes...)
+	if len(bs.Secrets) > 0 {
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", docker.secretsFile(bs), SecretsMountPath))
+	}
+	return volumes
+}
+
+func envList(env map[string]string) []string {
+	var ret []string
+	for name, value := range env {
+		ret = append(ret, fmt.Sprintf("%s=%s", name, value))
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Fields identifying container in log entries
+func (bs *BuildSettings) logEntry() *logging.Entry {
+	return logging.Request(bs.RequestId).Launch(bs.LaunchId).TestCase(bs.BuildData.TestCase.Id).ContainerType(bs.ContainerType).Image(bs.Image)
 }
 
 func marshalData(m interface{}) (string, error) {
@@ -94,23 +243,50 @@ func marshalData(m interface{}) (string, error) {
 	return string(data), nil
 }
 
-func (docker *Docker) waitFor(ctx context.Context, containerId string, finished chan bool) {
+func (docker *Docker) waitFor(ctx context.Context, containerId string, parent *tracing.Span, finished chan bool) {
 	//TODO: does this automatically exit on container removal?
+	span := tracing.StartClient("docker.container_wait", parent).SetAttribute("container.id", containerId)
 	statusCode, err := docker.client.ContainerWait(ctx, containerId)
-	success := err != nil && statusCode == 0
+	span.SetAttribute("exit_code", statusCode).SetError(err).End()
+	if err != nil {
+		dockerErrors.Inc(waitOperation)
+	}
+	success := err == nil && statusCode == 0
 	finished <- success
 }
 
-func (docker *Docker) removeContainer(ctx context.Context, containerId string, bs *BuildSettings) {
-	requestId := bs.RequestId
-	testCaseId := bs.BuildData.TestCase.Id
-	image := bs.Image
+// Lets build tool finish writing results before container is removed
+func (docker *Docker) stopAndRemove(ctx context.Context, containerId string, bs *BuildSettings) error {
+	timeout := docker.config.StopTimeout
+	if timeout > 0 {
+		entry := bs.logEntry().Container(containerId)
+		span := tracing.StartClient("docker.container_stop", bs.Span).SetAttribute("container.id", containerId)
+		err := docker.client.ContainerStop(ctx, containerId, &timeout)
+		span.SetError(err).End()
+		if err != nil {
+			dockerErrors.Inc(stopOperation)
+			entry.Err(err).Warn("FAILED_TO_STOP_CONTAINER")
+		}
+	}
+	return docker.removeContainer(ctx, containerId, bs)
+}
+
+func (docker *Docker) removeContainer(ctx context.Context, containerId string, bs *BuildSettings) error {
+	entry := bs.logEntry().Container(containerId)
 	containerRemoveTime := time.Now()
-	log.Printf("[%d] [REMOVING_CONTAINER] [%s] [%s] [%s]\n", requestId, testCaseId, image, containerId)
-	err := docker.client.ContainerRemove(ctx, containerId, types.ContainerRemoveOptions{RemoveVolumes: true})
+	entry.Info("REMOVING_CONTAINER")
+	span := tracing.StartClient("docker.container_remove", bs.Span).SetAttribute("container.id", containerId)
+	err := docker.client.ContainerRemove(ctx, containerId, types.ContainerRemoveOptions{RemoveVolumes: true, Force: true})
+	span.SetError(err).End()
+	if err := removeSecrets(docker.secretsFile(bs)); err != nil {
+		entry.Err(err).Error("FAILED_TO_REMOVE_SECRETS")
+	}
 	if err != nil {
-		log.Println("error: unable to remove container", containerId, err)
-		return
+		dockerErrors.Inc(removeOperation)
+		entry.Err(err).Error("FAILED_TO_REMOVE_CONTAINER")
+		return err
 	}
-	log.Printf("[%d] [CONTAINER_REMOVED] [%s] [%s] [%s] [%.2fs]\n", requestId, testCaseId, image, containerId, float64(time.Since(containerRemoveTime).Seconds()))
+	observeSince(containerRemoveSeconds, containerRemoveTime, bs.ContainerType)
+	entry.Duration(time.Since(containerRemoveTime)).Info("CONTAINER_REMOVED")
+	return nil
 }
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	"github.com/aerokube/rt/config"
+)
+
+// Mock Docker API answering container wait requests
+func waitServer(status int, exitCode int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/wait") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"StatusCode": %d}`, exitCode)
+	}))
+}
+
+func waitOutcome(t *testing.T, status int, exitCode int) bool {
+	srv := waitServer(status, exitCode)
+	defer srv.Close()
+	dockerHost := os.Getenv("DOCKER_HOST")
+	defer os.Setenv("DOCKER_HOST", dockerHost)
+	os.Setenv("DOCKER_HOST", "tcp://"+srv.Listener.Addr().String())
+	docker, err := NewDocker(config.NewConfig(os.TempDir(), time.Hour, time.Hour))
+	AssertThat(t, err, Is{nil})
+	_, finished := docker.Reattach(ManagedContainer{Id: "test-container"})
+	select {
+	case success := <-finished:
+		return success
+	case <-time.After(5 * time.Second):
+		t.Fatal("container wait did not finish")
+		return false
+	}
+}
+
+func TestWaitForPassed(t *testing.T) {
+	AssertThat(t, waitOutcome(t, http.StatusOK, 0), Is{true})
+}
+
+func TestWaitForFailed(t *testing.T) {
+	AssertThat(t, waitOutcome(t, http.StatusOK, 1), Is{false})
+	AssertThat(t, waitOutcome(t, http.StatusInternalServerError, 0), Is{false})
+}
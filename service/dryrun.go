@@ -0,0 +1,130 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/logging"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/template"
+)
+
+// Settings test case container would be created with
+type ContainerSpec struct {
+	Image     string            `json:"image"`
+	Command   []string          `json:"command"`
+	Env       []string          `json:"env"`
+	Volumes   []string          `json:"volumes"`
+	Tmpfs     map[string]string `json:"tmpfs"`
+	Templates map[string]string `json:"templates"` // Rendered build files by output path
+	Secrets   []Property        `json:"secrets,omitempty"`
+	Errors    []string          `json:"errors,omitempty"`
+}
+
+// Spec returns container settings without creating container, secret values are masked
+func (docker *Docker) Spec(bs *BuildSettings) *ContainerSpec {
+	spec := &ContainerSpec{
+		Image:     bs.Image,
+		Command:   bs.Command,
+		Volumes:   docker.containerVolumes(bs),
+		Tmpfs:     bs.Tmpfs,
+		Templates: make(map[string]string),
+		Secrets:   MaskProperties(bs.Secrets),
+	}
+	env, err := docker.containerEnv(bs)
+	if err != nil {
+		spec.Errors = append(spec.Errors, err.Error())
+	}
+	spec.Env = env
+	if _, err := bs.Limits.MemoryBytes(); err != nil {
+		spec.Errors = append(spec.Errors, fmt.Sprintf("invalid memory limit: %v", err))
+	}
+	return spec
+}
+
+// ReadTemplates copies template files from image using a container that is never started
+func (docker *Docker) ReadTemplates(image string, paths []string) (map[string]string, error) {
+	ret := make(map[string]string)
+	if len(paths) == 0 {
+		return ret, nil
+	}
+	ctx := context.Background()
+	resp, err := docker.client.ContainerCreate(ctx,
+		&container.Config{
+			Image:  image,
+			Cmd:    []string{"true"},
+			Labels: map[string]string{InstanceIdLabel: docker.config.InstanceId, DryRunLabel: "true"},
+		},
+		&container.HostConfig{}, &network.NetworkingConfig{}, "")
+	if err != nil {
+		dockerErrors.Inc(createOperation)
+		return nil, fmt.Errorf("failed to create container: %v", err)
+	}
+	defer func() {
+		err := docker.client.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{RemoveVolumes: true, Force: true})
+		if err != nil {
+			dockerErrors.Inc(removeOperation)
+			logging.Err(err).Container(resp.ID).Image(image).Error("FAILED_TO_REMOVE_CONTAINER")
+		}
+	}()
+	for _, path := range paths {
+		content, err := docker.copyFile(ctx, resp.ID, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s: %v", path, err)
+		}
+		ret[path] = content
+	}
+	return ret, nil
+}
+
+func (docker *Docker) copyFile(ctx context.Context, containerId string, path string) (string, error) {
+	rc, _, err := docker.client.CopyFromContainer(ctx, containerId, path)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return "", fmt.Errorf("not a regular file")
+		}
+		if err != nil {
+			return "", err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			data, err := ioutil.ReadAll(tr)
+			return string(data), err
+		}
+	}
+}
+
+// RenderTemplates executes templates the same way runner does returning build files by output path
+func RenderTemplates(templates map[string]string, sources map[string]string, data StandaloneTestCase) (map[string]string, error) {
+	ret := make(map[string]string)
+	var paths []string
+	for path := range templates {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		t, err := template.New(path).Parse(sources[path])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template file \"%s\": %v", path, err)
+		}
+		var buf bytes.Buffer
+		err = t.Execute(&buf, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate build file \"%s\": %v", templates[path], err)
+		}
+		ret[templates[path]] = buf.String()
+	}
+	return ret, nil
+}
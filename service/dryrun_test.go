@@ -0,0 +1,58 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+)
+
+func TestSpec(t *testing.T) {
+	conf := config.NewConfig("/var/lib/rt", time.Hour, time.Minute)
+	conf.SecretsDir = "/run/rt-secrets"
+	docker := &Docker{dataDir: conf.DataDir, config: conf}
+	bs := &BuildSettings{
+		LaunchId:  "launch-1",
+		Image:     "aerokube/maven:latest",
+		Command:   []string{"mvn", "verify"},
+		DataDir:   "/data",
+		Volumes:   []string{"/root/.m2:/root/.m2"},
+		Tmpfs:     map[string]string{"/tmp": "size=128m"},
+		Env:       map[string]string{"MAVEN_OPTS": "-Xmx512m"},
+		BuildData: StandaloneTestCase{TestCase: TestCase{Id: "tc-1"}, SecretsFile: SecretsMountPath},
+		Secrets:   []Property{{Key: "password", Value: "s3cr3t", Secret: true}},
+	}
+	spec := docker.Spec(bs)
+	AssertThat(t, spec.Image, EqualTo{"aerokube/maven:latest"})
+	AssertThat(t, spec.Volumes, EqualTo{[]string{
+		"/var/lib/rt/launch-1/tc-1:/data",
+		"/root/.m2:/root/.m2",
+		"/run/rt-secrets/launch-1/tc-1.properties:" + SecretsMountPath + ":ro",
+	}})
+	AssertThat(t, spec.Secrets, EqualTo{[]Property{{Key: "password", Value: Masked, Secret: true}}})
+	AssertThat(t, spec.Env[len(spec.Env)-2:], EqualTo{[]string{SecretsFile + "=" + SecretsMountPath, "MAVEN_OPTS=-Xmx512m"}})
+	for _, e := range spec.Env {
+		AssertThat(t, strings.Contains(e, "s3cr3t"), Is{false})
+	}
+	AssertThat(t, len(spec.Errors), EqualTo{0})
+}
+
+func TestRenderTemplates(t *testing.T) {
+	templates := map[string]string{"/pom.xml.tmpl": "/data/pom.xml"}
+	data := StandaloneTestCase{
+		TestCase:    TestCase{Id: "tc-1", Name: "Test#one"},
+		Properties:  []Property{{Key: "key1", Value: "value1"}},
+		SecretsFile: SecretsMountPath,
+	}
+	rendered, err := RenderTemplates(templates, map[string]string{
+		"/pom.xml.tmpl": "{{ .TestCase.Name }}{{ range .Properties }} {{ .Key }}={{ .Value }}{{ end }} {{ .SecretsFile }}",
+	}, data)
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, rendered, EqualTo{map[string]string{"/data/pom.xml": "Test#one key1=value1 " + SecretsMountPath}})
+
+	_, err = RenderTemplates(templates, map[string]string{"/pom.xml.tmpl": "{{ .Missing }}"}, data)
+	AssertThat(t, err, Is{Not{nil}})
+}
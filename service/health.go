@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"fmt"
+)
+
+// Ping checks that Docker API is reachable
+func (docker *Docker) Ping(ctx context.Context) error {
+	_, err := docker.client.Ping(ctx)
+	if err != nil {
+		dockerErrors.Inc(pingOperation)
+		return fmt.Errorf("failed to ping Docker: %v", err)
+	}
+	return nil
+}
+
+// InspectImage checks that image is present on Docker host
+func (docker *Docker) InspectImage(ctx context.Context, image string) error {
+	_, _, err := docker.client.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		dockerErrors.Inc(imageOperation)
+		return fmt.Errorf("image %s is not available: %v", image, err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"io"
+)
+
+// Container output streams
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+var ErrContainerNotFound = errors.New("container not found")
+
+// Log line printed by container
+type LogLine struct {
+	Stream string
+	Text   string
+}
+
+// StreamLogs sends container output to lines channel until container stops
+// (when follow is true) or context is cancelled. Tail is the number of last lines to start with or "all".
+func (docker *Docker) StreamLogs(ctx context.Context, containerId string, follow bool, tail string, lines chan<- LogLine) error {
+	logs, err := docker.client.ContainerLogs(ctx, containerId, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     follow,
+		Tail:       tail,
+	})
+	if err != nil {
+		dockerErrors.Inc(logsOperation)
+		return fmt.Errorf("failed to read container logs: %v", err)
+	}
+	defer logs.Close()
+	return demultiplex(logs, lines)
+}
+
+// FindContainer returns ID of container running test case
+func (docker *Docker) FindContainer(testCaseId string) (string, error) {
+	containers, err := docker.ListContainers()
+	if err != nil {
+		return "", err
+	}
+	for _, mc := range containers {
+		if mc.TestCaseId == testCaseId {
+			return mc.Id, nil
+		}
+	}
+	return "", ErrContainerNotFound
+}
+
+// Splits Docker multiplexed stream into lines. Every frame has 8 bytes header:
+// stream type (1 - stdout, 2 - stderr), three zero bytes and big endian payload size.
+func demultiplex(r io.Reader, lines chan<- LogLine) error {
+	reader := bufio.NewReader(r)
+	buffers := map[string]*bytes.Buffer{Stdout: {}, Stderr: {}}
+	header := make([]byte, 8)
+	for {
+		_, err := io.ReadFull(reader, header)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read log frame header: %v", err)
+		}
+		stream := Stdout
+		if header[0] == 2 {
+			stream = Stderr
+		}
+		size := binary.BigEndian.Uint32(header[4:])
+		buf := buffers[stream]
+		if _, err := io.CopyN(buf, reader, int64(size)); err != nil {
+			return fmt.Errorf("failed to read log frame: %v", err)
+		}
+		for {
+			i := bytes.IndexByte(buf.Bytes(), '\n')
+			if i < 0 {
+				break
+			}
+			line := string(buf.Next(i + 1))
+			lines <- LogLine{Stream: stream, Text: line[:len(line)-1]}
+		}
+	}
+	for _, stream := range []string{Stdout, Stderr} {
+		if buffers[stream].Len() > 0 {
+			lines <- LogLine{Stream: stream, Text: buffers[stream].String()}
+		}
+	}
+	return nil
+}
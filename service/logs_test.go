@@ -0,0 +1,41 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	. "github.com/aandryashin/matchers"
+)
+
+func frame(stream byte, payload string) []byte {
+	header := []byte{stream, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func TestDemultiplex(t *testing.T) {
+	var data []byte
+	data = append(data, frame(1, "first li")...)
+	data = append(data, frame(2, "error\n")...)
+	data = append(data, frame(1, "ne\nsecond line\nunfinished")...)
+	lines := make(chan LogLine, 10)
+	AssertThat(t, demultiplex(bytes.NewReader(data), lines), Is{nil})
+	close(lines)
+	var got []LogLine
+	for line := range lines {
+		got = append(got, line)
+	}
+	AssertThat(t, got, EqualTo{[]LogLine{
+		{Stream: Stderr, Text: "error"},
+		{Stream: Stdout, Text: "first line"},
+		{Stream: Stdout, Text: "second line"},
+		{Stream: Stdout, Text: "unfinished"},
+	}})
+}
+
+func TestDemultiplexTruncatedFrame(t *testing.T) {
+	data := frame(1, "line\n")
+	lines := make(chan LogLine, 10)
+	AssertThat(t, demultiplex(bytes.NewReader(data[:len(data)-2]), lines), Is{Not{nil}})
+}
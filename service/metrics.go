@@ -0,0 +1,30 @@
+package service
+
+import (
+	"github.com/aerokube/rt/metrics"
+	"time"
+)
+
+var (
+	containerCreateSeconds = metrics.NewHistogram("rt_container_create_seconds", "Time to create container.", metrics.DurationBuckets, "container_type")
+	containerStartSeconds  = metrics.NewHistogram("rt_container_start_seconds", "Time to start container.", metrics.DurationBuckets, "container_type")
+	containerRemoveSeconds = metrics.NewHistogram("rt_container_remove_seconds", "Time to remove container.", metrics.DurationBuckets, "container_type")
+	dockerErrors           = metrics.NewCounter("rt_docker_errors_total", "Failed Docker API calls.", "operation")
+)
+
+// Docker API operations
+const (
+	createOperation = "create"
+	startOperation  = "start"
+	stopOperation   = "stop"
+	removeOperation = "remove"
+	listOperation   = "list"
+	waitOperation   = "wait"
+	logsOperation   = "logs"
+	pingOperation   = "ping"
+	imageOperation  = "inspect_image"
+)
+
+func observeSince(h *metrics.Histogram, start time.Time, containerType string) {
+	h.Observe(time.Since(start).Seconds(), containerType)
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/aerokube/rt/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// Path inside container secret properties file is mounted to
+const SecretsMountPath = "/run/rt/secrets.properties"
+
+// Host file with secret properties of test case, removed together with container
+func (docker *Docker) secretsFile(bs *BuildSettings) string {
+	return filepath.Join(docker.config.SecretsDir, bs.LaunchId, bs.BuildData.TestCase.Id+".properties")
+}
+
+// Writes secret properties readable by owner only
+func writeSecrets(path string, secrets []Property) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create secrets directory: %v", err)
+	}
+	err = ioutil.WriteFile(path, formatProperties(secrets), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write secrets: %v", err)
+	}
+	return nil
+}
+
+// Removes secrets file and launch directory when it becomes empty
+func removeSecrets(path string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	os.Remove(filepath.Dir(path))
+	return nil
+}
+
+// Formats properties as Java properties file
+func formatProperties(properties []Property) []byte {
+	var buf bytes.Buffer
+	for _, p := range properties {
+		buf.WriteString(escapeProperty(p.Key, true))
+		buf.WriteString("=")
+		buf.WriteString(escapeProperty(p.Value, false))
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+func escapeProperty(s string, key bool) string {
+	var buf strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '=' || r == ':' || r == '#' || r == '!':
+			buf.WriteRune('\\')
+			buf.WriteRune(r)
+		case r == ' ' && (key || i == 0):
+			buf.WriteString(`\ `)
+		case r < 0x20 || r > 0x7e:
+			for _, c := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&buf, `\u%04x`, c)
+			}
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/aandryashin/matchers"
+	. "github.com/aerokube/rt/common"
+)
+
+func TestFormatProperties(t *testing.T) {
+	data := formatProperties([]Property{
+		{Key: "db.password", Value: "p@ss=word:1"},
+		{Key: "odd key", Value: " leading space\nand ünicode"},
+		{Key: "path", Value: `C:\temp`},
+	})
+	AssertThat(t, string(data), EqualTo{"db.password=p@ss\\=word\\:1\nodd\\ key=\\ leading space\\nand \\u00fcnicode\npath=C\\:\\\\temp\n"})
+}
+
+func TestWriteAndRemoveSecrets(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "rt-secrets")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "launch-1", "tc-1.properties")
+	AssertThat(t, writeSecrets(path, []Property{{Key: "password", Value: "s3cr3t", Secret: true}}), Is{nil})
+	fi, err := os.Stat(path)
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, fi.Mode().Perm(), EqualTo{os.FileMode(0600)})
+
+	AssertThat(t, removeSecrets(path), Is{nil})
+	_, err = os.Stat(filepath.Dir(path))
+	AssertThat(t, os.IsNotExist(err), Is{true})
+	AssertThat(t, removeSecrets(path), Is{nil})
+}
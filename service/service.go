@@ -1,6 +1,10 @@
 package service
 
-import . "github.com/aerokube/rt/common"
+import (
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/config"
+	"github.com/aerokube/rt/tracing"
+)
 
 type Starter interface {
 	StartWithCancel(bs *BuildSettings) (func(), <-chan bool, error)
@@ -8,12 +12,18 @@ type Starter interface {
 
 // Build settings
 type BuildSettings struct {
-	RequestId RequestId
-	Image     string
-	Command   []string
-	Tmpfs     map[string]string
-	DataDir   string //Data directory inside container
-	Templates map[string]string
-	Volumes   []string
-	BuildData StandaloneTestCase
+	RequestId     RequestId
+	LaunchId      string
+	ContainerType string
+	Image         string
+	Command       []string
+	Tmpfs         map[string]string
+	DataDir       string //Data directory inside container
+	Templates     map[string]string
+	Volumes       []string
+	Env           map[string]string
+	Limits        config.Limits
+	BuildData     StandaloneTestCase
+	Secrets       []Property    // Mounted to container as a file, never passed in command or environment
+	Span          *tracing.Span // Test case span, Docker calls are traced as its children
 }
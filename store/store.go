@@ -0,0 +1,340 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/logging"
+	bolt "go.etcd.io/bbolt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	launchesBucket  = []byte("launches")
+	testCasesBucket = []byte("testcases")           // Keyed by <test case id>/<attempt>, so attempts of one test case are found by prefix
+	byLaunchBucket  = []byte("testcases-by-launch") // <launch id>/<test case key> index with empty values
+)
+
+// Test case outcomes
+const (
+	Running    = "running"
+	NotStarted = "not_started"
+	Passed     = "passed"
+	Failed     = "failed"
+	Revoked    = "revoked"
+	TimedOut   = "timed_out"
+)
+
+type LaunchRecord struct {
+	Id         string     `json:"id"`
+	Type       string     `json:"type"`
+	Container  string     `json:"container"`
+	TestCases  []string   `json:"testcases"`
+	Properties []Property `json:"properties,omitempty"` // Secret values are masked
+	Started    time.Time  `json:"started"`
+	Finished   time.Time  `json:"finished,omitempty"`
+	Owner      string     `json:"owner,omitempty"` // Name of API token launch was created with
+}
+
+// A single attempt to run a test case
+type TestCaseRecord struct {
+	Id           string    `json:"id"`
+	LaunchId     string    `json:"launchId"`
+	Name         string    `json:"name"`
+	Tags         []string  `json:"tags"`
+	Attempt      int       `json:"attempt"`
+	Outcome      string    `json:"outcome"`
+	Started      time.Time `json:"started"`
+	Finished     time.Time `json:"finished,omitempty"`
+	Duration     float64   `json:"duration"` // Seconds
+	ArtifactPath string    `json:"artifactPath"`
+	ArtifactUrls []string  `json:"artifactUrls,omitempty"` // Uploaded copies of artifacts
+	Owner        string    `json:"owner,omitempty"`
+}
+
+// Test case history query, empty fields match everything
+type Query struct {
+	Id       string
+	LaunchId string
+	Name     string
+	Tag      string
+	Outcome  string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Owner    string
+}
+
+// Persistent launch history stored in a BoltDB file
+type Store struct {
+	db     *bolt.DB
+	lock   sync.RWMutex // Held for writing by Close, so it waits for writes in progress
+	closed bool
+}
+
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{launchesBucket, testCasesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(byLaunchBucket) != nil {
+			return nil
+		}
+		return indexByLaunch(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize history database: %v", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close waits for writes in progress, later writes are skipped. Launches still
+// running when rt gives up draining can finish after history is closed.
+func (s *Store) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.db.Close()
+}
+
+func (s *Store) update(fn func(tx *bolt.Tx) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		logging.Warn("HISTORY_CLOSED")
+		return nil
+	}
+	return s.db.Update(fn)
+}
+
+// Builds launch index of history saved before it was introduced
+func indexByLaunch(tx *bolt.Tx) error {
+	index, err := tx.CreateBucket(byLaunchBucket)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(testCasesBucket).ForEach(func(k, data []byte) error {
+		var tc TestCaseRecord
+		if err := json.Unmarshal(data, &tc); err != nil {
+			return err
+		}
+		return index.Put(launchKey(tc.LaunchId, k), []byte{})
+	})
+}
+
+func (s *Store) PutLaunch(launch *LaunchRecord) error {
+	return s.put(launchesBucket, []byte(launch.Id), launch)
+}
+
+func (s *Store) GetLaunch(launchId string) (*LaunchRecord, bool, error) {
+	var launch *LaunchRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(launchesBucket).Get([]byte(launchId))
+		if data == nil {
+			return nil
+		}
+		launch = new(LaunchRecord)
+		return json.Unmarshal(data, launch)
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read launch %s: %v", launchId, err)
+	}
+	return launch, launch != nil, nil
+}
+
+// AddTestCase saves test case as its next attempt
+func (s *Store) AddTestCase(tc *TestCaseRecord) error {
+	return s.update(func(tx *bolt.Tx) error {
+		attempts := 0
+		forEachPrefix(tx.Bucket(testCasesBucket), tc.Id+"/", func(_, _ []byte) error {
+			attempts++
+			return nil
+		})
+		tc.Attempt = attempts + 1
+		return putTestCase(tx, tc)
+	})
+}
+
+// UpdateTestCase overwrites previously added test case attempt
+func (s *Store) UpdateTestCase(tc *TestCaseRecord) error {
+	return s.update(func(tx *bolt.Tx) error {
+		return putTestCase(tx, tc)
+	})
+}
+
+func putTestCase(tx *bolt.Tx, tc *TestCaseRecord) error {
+	key := testCaseKey(tc)
+	err := putJSON(tx.Bucket(testCasesBucket), key, tc)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(byLaunchBucket).Put(launchKey(tc.LaunchId, key), []byte{})
+}
+
+// DeleteLaunches removes launches finished before given time with all their test cases
+// returning number of removed launches
+func (s *Store) DeleteLaunches(before time.Time) (int, error) {
+	var expired []string
+	err := s.update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(launchesBucket).ForEach(func(k, data []byte) error {
+			var launch LaunchRecord
+			if err := json.Unmarshal(data, &launch); err != nil {
+				return err
+			}
+			if !launch.Finished.IsZero() && launch.Finished.Before(before) {
+				expired = append(expired, string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, launchId := range expired {
+			var keys [][]byte
+			forEachPrefix(tx.Bucket(byLaunchBucket), launchId+"/", func(k, _ []byte) error {
+				keys = append(keys, append([]byte(nil), k...))
+				return nil
+			})
+			for _, k := range keys {
+				if err := tx.Bucket(testCasesBucket).Delete(k[len(launchId)+1:]); err != nil {
+					return err
+				}
+				if err := tx.Bucket(byLaunchBucket).Delete(k); err != nil {
+					return err
+				}
+			}
+			if err := tx.Bucket(launchesBucket).Delete([]byte(launchId)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete launches: %v", err)
+	}
+	return len(expired), nil
+}
+
+// FindTestCases returns test case attempts matching query ordered by start time
+func (s *Store) FindTestCases(q Query) ([]TestCaseRecord, error) {
+	ret := []TestCaseRecord{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(testCasesBucket)
+		add := func(data []byte) error {
+			var tc TestCaseRecord
+			if err := json.Unmarshal(data, &tc); err != nil {
+				return err
+			}
+			if q.matches(&tc) {
+				ret = append(ret, tc)
+			}
+			return nil
+		}
+		switch {
+		case q.Id != "":
+			return forEachPrefix(b, q.Id+"/", func(_, data []byte) error {
+				return add(data)
+			})
+		case q.LaunchId != "":
+			return forEachPrefix(tx.Bucket(byLaunchBucket), q.LaunchId+"/", func(k, _ []byte) error {
+				if data := b.Get(k[len(q.LaunchId)+1:]); data != nil {
+					return add(data)
+				}
+				return nil
+			})
+		default:
+			return b.ForEach(func(_, data []byte) error {
+				return add(data)
+			})
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query test cases: %v", err)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Started.Before(ret[j].Started)
+	})
+	if q.Limit > 0 && len(ret) > q.Limit {
+		ret = ret[len(ret)-q.Limit:]
+	}
+	return ret, nil
+}
+
+func (q Query) matches(tc *TestCaseRecord) bool {
+	if q.Id != "" && tc.Id != q.Id {
+		return false
+	}
+	if q.LaunchId != "" && tc.LaunchId != q.LaunchId {
+		return false
+	}
+	if q.Owner != "" && tc.Owner != q.Owner {
+		return false
+	}
+	if q.Name != "" && tc.Name != q.Name {
+		return false
+	}
+	if q.Outcome != "" && tc.Outcome != q.Outcome {
+		return false
+	}
+	if !q.From.IsZero() && tc.Started.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && tc.Started.After(q.To) {
+		return false
+	}
+	if q.Tag != "" {
+		for _, tag := range tc.Tags {
+			if tag == q.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (s *Store) put(bucket []byte, key []byte, v interface{}) error {
+	return s.update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucket), key, v)
+	})
+}
+
+func putJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %v", err)
+	}
+	return b.Put(key, data)
+}
+
+func testCaseKey(tc *TestCaseRecord) []byte {
+	return []byte(fmt.Sprintf("%s/%06d", tc.Id, tc.Attempt))
+}
+
+func launchKey(launchId string, testCaseKey []byte) []byte {
+	return append([]byte(launchId+"/"), testCaseKey...)
+}
+
+// Calls fn for every key starting with prefix in key order
+func forEachPrefix(b *bolt.Bucket, prefix string, fn func(k, v []byte) error) error {
+	c := b.Cursor()
+	for k, v := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	bolt "go.etcd.io/bbolt"
+)
+
+func withStore(t *testing.T, fn func(*Store)) {
+	dir, err := ioutil.TempDir("", "rt-store")
+	AssertThat(t, err, Is{nil})
+	defer os.RemoveAll(dir)
+	s, err := Open(path.Join(dir, "history.db"))
+	AssertThat(t, err, Is{nil})
+	defer s.Close()
+	fn(s)
+}
+
+func TestPutAndGetLaunch(t *testing.T) {
+	withStore(t, func(s *Store) {
+		started := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+		AssertThat(t, s.PutLaunch(&LaunchRecord{Id: "launch-1", Type: "maven", TestCases: []string{"tc-1"}, Started: started}), Is{nil})
+
+		launch, ok, err := s.GetLaunch("launch-1")
+		AssertThat(t, err, Is{nil})
+		AssertThat(t, ok, Is{true})
+		AssertThat(t, launch.Started.Equal(started), Is{true})
+		AssertThat(t, launch.TestCases, EqualTo{[]string{"tc-1"}})
+
+		_, ok, err = s.GetLaunch("missing")
+		AssertThat(t, err, Is{nil})
+		AssertThat(t, ok, Is{false})
+	})
+}
+
+func TestAttemptsAndQueries(t *testing.T) {
+	withStore(t, func(s *Store) {
+		day := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+		first := &TestCaseRecord{Id: "tc-1", LaunchId: "launch-1", Name: "Test#one", Tags: []string{"smoke"}, Outcome: Running, Started: day}
+		AssertThat(t, s.AddTestCase(first), Is{nil})
+		AssertThat(t, first.Attempt, EqualTo{1})
+		first.Outcome = Failed
+		AssertThat(t, s.UpdateTestCase(first), Is{nil})
+
+		second := &TestCaseRecord{Id: "tc-1", LaunchId: "launch-2", Name: "Test#one", Tags: []string{"smoke"}, Outcome: Passed, Started: day.Add(24 * time.Hour)}
+		AssertThat(t, s.AddTestCase(second), Is{nil})
+		AssertThat(t, second.Attempt, EqualTo{2})
+
+		other := &TestCaseRecord{Id: "tc-2", LaunchId: "launch-2", Name: "Test#two", Outcome: Passed, Started: day.Add(25 * time.Hour)}
+		AssertThat(t, s.AddTestCase(other), Is{nil})
+
+		all, err := s.FindTestCases(Query{})
+		AssertThat(t, err, Is{nil})
+		AssertThat(t, len(all), EqualTo{3})
+
+		byName, _ := s.FindTestCases(Query{Name: "Test#one"})
+		AssertThat(t, len(byName), EqualTo{2})
+		AssertThat(t, byName[0].Outcome, EqualTo{Failed})
+
+		byId, _ := s.FindTestCases(Query{Id: "tc-2"})
+		AssertThat(t, len(byId), EqualTo{1})
+
+		byLaunch, _ := s.FindTestCases(Query{LaunchId: "launch-2"})
+		AssertThat(t, len(byLaunch), EqualTo{2})
+
+		byTag, _ := s.FindTestCases(Query{Tag: "smoke", Outcome: Passed})
+		AssertThat(t, len(byTag), EqualTo{1})
+		AssertThat(t, byTag[0].LaunchId, EqualTo{"launch-2"})
+
+		byDate, _ := s.FindTestCases(Query{From: day.Add(time.Hour), To: day.Add(24 * time.Hour)})
+		AssertThat(t, len(byDate), EqualTo{1})
+
+		latest, _ := s.FindTestCases(Query{Limit: 1})
+		AssertThat(t, len(latest), EqualTo{1})
+		AssertThat(t, latest[0].Id, EqualTo{"tc-2"})
+	})
+}
+
+func TestDeleteLaunches(t *testing.T) {
+	withStore(t, func(s *Store) {
+		day := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+		AssertThat(t, s.PutLaunch(&LaunchRecord{Id: "old", TestCases: []string{"tc-1"}, Started: day, Finished: day.Add(time.Hour)}), Is{nil})
+		AssertThat(t, s.PutLaunch(&LaunchRecord{Id: "new", TestCases: []string{"tc-1"}, Started: day.Add(48 * time.Hour), Finished: day.Add(49 * time.Hour)}), Is{nil})
+		AssertThat(t, s.PutLaunch(&LaunchRecord{Id: "unfinished", TestCases: []string{"tc-2"}, Started: day}), Is{nil})
+		AssertThat(t, s.AddTestCase(&TestCaseRecord{Id: "tc-1", LaunchId: "old", Started: day}), Is{nil})
+		AssertThat(t, s.AddTestCase(&TestCaseRecord{Id: "tc-1", LaunchId: "new", Started: day.Add(48 * time.Hour)}), Is{nil})
+		AssertThat(t, s.AddTestCase(&TestCaseRecord{Id: "tc-2", LaunchId: "unfinished", Started: day}), Is{nil})
+
+		deleted, err := s.DeleteLaunches(day.Add(24 * time.Hour))
+		AssertThat(t, err, Is{nil})
+		AssertThat(t, deleted, EqualTo{1})
+		_, ok, _ := s.GetLaunch("old")
+		AssertThat(t, ok, Is{false})
+		_, ok, _ = s.GetLaunch("unfinished")
+		AssertThat(t, ok, Is{true})
+		byId, _ := s.FindTestCases(Query{Id: "tc-1"})
+		AssertThat(t, len(byId), EqualTo{1})
+		AssertThat(t, byId[0].LaunchId, EqualTo{"new"})
+		byLaunch, _ := s.FindTestCases(Query{LaunchId: "old"})
+		AssertThat(t, len(byLaunch), EqualTo{0})
+	})
+}
+
+func TestLaunchIndexBuiltOnOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rt-store")
+	AssertThat(t, err, Is{nil})
+	defer os.RemoveAll(dir)
+	s, err := Open(path.Join(dir, "history.db"))
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, s.AddTestCase(&TestCaseRecord{Id: "tc-1", LaunchId: "launch-1"}), Is{nil})
+	AssertThat(t, s.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(byLaunchBucket)
+	}), Is{nil})
+	AssertThat(t, s.Close(), Is{nil})
+
+	s, err = Open(path.Join(dir, "history.db"))
+	AssertThat(t, err, Is{nil})
+	defer s.Close()
+	byLaunch, err := s.FindTestCases(Query{LaunchId: "launch-1"})
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, len(byLaunch), EqualTo{1})
+}
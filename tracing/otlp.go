@@ -0,0 +1,240 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aerokube/rt/logging"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize     = 2048
+	batchSize     = 256
+	flushInterval = 5 * time.Second
+	scopeName     = "github.com/aerokube/rt"
+)
+
+var (
+	exporterLock sync.RWMutex
+	current      *exporter
+)
+
+// Sends finished spans in batches to OTLP/HTTP collector
+type exporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+	spans       chan *Span
+	flush       chan chan struct{}
+}
+
+// Configure enables export to OTLP collector endpoint like http://localhost:4318
+func Configure(endpoint string, serviceName string) {
+	e := &exporter{
+		url:         strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		spans:       make(chan *Span, queueSize),
+		flush:       make(chan chan struct{}),
+	}
+	exporterLock.Lock()
+	current = e
+	exporterLock.Unlock()
+	go e.run()
+}
+
+// Flush sends all queued spans waiting no longer than timeout
+func Flush(timeout time.Duration) {
+	exporterLock.RLock()
+	e := current
+	exporterLock.RUnlock()
+	if e == nil {
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case e.flush <- done:
+		select {
+		case <-done:
+		case <-time.After(timeout):
+		}
+	case <-time.After(timeout):
+	}
+}
+
+func export(s *Span) {
+	exporterLock.RLock()
+	e := current
+	exporterLock.RUnlock()
+	if e == nil {
+		return
+	}
+	select {
+	case e.spans <- s:
+	default:
+		logging.With("span", s.name).Warn("SPAN_DROPPED")
+	}
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	var batch []*Span
+	for {
+		select {
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				e.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = nil
+		case done := <-e.flush:
+			for drained := false; !drained; {
+				select {
+				case s := <-e.spans:
+					batch = append(batch, s)
+				default:
+					drained = true
+				}
+			}
+			e.send(batch)
+			batch = nil
+			close(done)
+		}
+	}
+}
+
+func (e *exporter) send(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+	data, err := json.Marshal(e.request(batch))
+	if err != nil {
+		logging.Err(err).Error("FAILED_TO_EXPORT_SPANS")
+		return
+	}
+	rsp, err := e.client.Post(e.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		logging.With("spans", len(batch)).Err(err).Error("FAILED_TO_EXPORT_SPANS")
+		return
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		logging.With("spans", len(batch)).Err(fmt.Errorf("collector responded with %s", rsp.Status)).Error("FAILED_TO_EXPORT_SPANS")
+	}
+}
+
+// OTLP/HTTP JSON encoding of trace export request
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanData `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type spanData struct {
+	TraceId           string     `json:"traceId"`
+	SpanId            string     `json:"spanId"`
+	ParentSpanId      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type status struct {
+	Code    int    `json:"code"` // 1 - ok, 2 - error
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func toAnyValue(v interface{}) anyValue {
+	switch value := v.(type) {
+	case string:
+		return anyValue{StringValue: &value}
+	case bool:
+		return anyValue{BoolValue: &value}
+	case int:
+		s := strconv.Itoa(value)
+		return anyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		return anyValue{IntValue: &s}
+	case uint64:
+		s := strconv.FormatUint(value, 10)
+		return anyValue{IntValue: &s}
+	case float64:
+		return anyValue{DoubleValue: &value}
+	default:
+		s := fmt.Sprint(value)
+		return anyValue{StringValue: &s}
+	}
+}
+
+func (e *exporter) request(batch []*Span) exportRequest {
+	var spans []spanData
+	for _, s := range batch {
+		s.lock.Lock()
+		sd := spanData{
+			TraceId:           s.TraceId(),
+			SpanId:            s.SpanId(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            status{Code: 1},
+		}
+		if s.parentId != [8]byte{} {
+			sd.ParentSpanId = hex.EncodeToString(s.parentId[:])
+		}
+		for _, a := range s.attributes {
+			sd.Attributes = append(sd.Attributes, keyValue{a.key, toAnyValue(a.value)})
+		}
+		if s.err != "" {
+			sd.Status = status{Code: 2, Message: s.err}
+		}
+		s.lock.Unlock()
+		spans = append(spans, sd)
+	}
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: []keyValue{{"service.name", toAnyValue(e.serviceName)}}},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: scopeName}, Spans: spans}},
+	}}}
+}
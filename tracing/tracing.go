@@ -0,0 +1,139 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// W3C trace context header
+const TraceParentHeader = "traceparent"
+
+// Span kinds as defined by OTLP
+const (
+	internalKind = 1
+	serverKind   = 2
+	clientKind   = 3
+)
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+// Span is a timed operation. Spans are created even when export is disabled
+// so that trace context is always passed to containers.
+type Span struct {
+	lock       sync.Mutex
+	traceId    [16]byte
+	id         [8]byte
+	parentId   [8]byte
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes []attribute
+	err        string
+	ended      bool
+}
+
+func newSpan(name string, kind int) *Span {
+	s := &Span{name: name, kind: kind, start: time.Now()}
+	rand.Read(s.id[:])
+	return s
+}
+
+// Start creates a child of parent span or a new trace when parent is nil
+func Start(name string, parent *Span) *Span {
+	s := newSpan(name, internalKind)
+	if parent != nil {
+		s.traceId, s.parentId = parent.traceId, parent.id
+	} else {
+		rand.Read(s.traceId[:])
+	}
+	return s
+}
+
+// StartClient creates a span for a call to external service like Docker
+func StartClient(name string, parent *Span) *Span {
+	s := Start(name, parent)
+	s.kind = clientKind
+	return s
+}
+
+// StartRemote creates a span continuing trace from traceparent header, a new trace is started when header is empty or invalid
+func StartRemote(name string, traceParent string) *Span {
+	s := newSpan(name, serverKind)
+	traceId, parentId, err := ParseTraceParent(traceParent)
+	if err != nil {
+		rand.Read(s.traceId[:])
+		return s
+	}
+	s.traceId, s.parentId = traceId, parentId
+	return s
+}
+
+// ParseTraceParent parses header like 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceParent(header string) ([16]byte, [8]byte, error) {
+	var traceId [16]byte
+	var parentId [8]byte
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return traceId, parentId, fmt.Errorf("invalid traceparent: %s", header)
+	}
+	if n, err := hex.Decode(traceId[:], []byte(parts[1])); err != nil || n != len(traceId) || len(parts[1]) != 32 || traceId == [16]byte{} {
+		return traceId, parentId, fmt.Errorf("invalid trace ID: %s", parts[1])
+	}
+	if n, err := hex.Decode(parentId[:], []byte(parts[2])); err != nil || n != len(parentId) || len(parts[2]) != 16 || parentId == [8]byte{} {
+		return traceId, parentId, fmt.Errorf("invalid parent ID: %s", parts[2])
+	}
+	return traceId, parentId, nil
+}
+
+func (s *Span) TraceId() string {
+	return hex.EncodeToString(s.traceId[:])
+}
+
+func (s *Span) SpanId() string {
+	return hex.EncodeToString(s.id[:])
+}
+
+// TraceParent returns W3C traceparent header value with this span as parent
+func (s *Span) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.TraceId(), s.SpanId())
+}
+
+// SetAttribute adds string, bool, integer or float attribute
+func (s *Span) SetAttribute(key string, value interface{}) *Span {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.attributes = append(s.attributes, attribute{key, value})
+	return s
+}
+
+// SetError marks span as failed
+func (s *Span) SetError(err error) *Span {
+	if err == nil {
+		return s
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.err = strings.TrimSpace(err.Error())
+	return s
+}
+
+// End finishes span and queues it for export, subsequent calls do nothing
+func (s *Span) End() {
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.lock.Unlock()
+	export(s)
+}
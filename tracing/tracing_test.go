@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	traceId, parentId, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	AssertThat(t, err, Is{nil})
+	AssertThat(t, traceId[0], EqualTo{byte(0x4b)})
+	AssertThat(t, parentId[7], EqualTo{byte(0xb7)})
+
+	for _, header := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-xyz92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		_, _, err := ParseTraceParent(header)
+		AssertThat(t, err, Is{Not{nil}})
+	}
+}
+
+func TestStartRemote(t *testing.T) {
+	span := StartRemote("POST /launch", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	AssertThat(t, span.TraceId(), EqualTo{"4bf92f3577b34da6a3ce929d0e0e4736"})
+	child := Start("launch", span)
+	AssertThat(t, child.TraceId(), EqualTo{span.TraceId()})
+	AssertThat(t, child.TraceParent(), EqualTo{"00-4bf92f3577b34da6a3ce929d0e0e4736-" + child.SpanId() + "-01"})
+
+	invalid := StartRemote("POST /launch", "garbage")
+	AssertThat(t, len(invalid.TraceId()), EqualTo{32})
+	AssertThat(t, invalid.TraceId() == span.TraceId(), Is{false})
+}
+
+func TestExport(t *testing.T) {
+	requests := make(chan exportRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var req exportRequest
+		json.Unmarshal(body, &req)
+		requests <- req
+	}))
+	defer srv.Close()
+	Configure(srv.URL, "rt-test")
+	defer func() {
+		exporterLock.Lock()
+		current = nil
+		exporterLock.Unlock()
+	}()
+
+	parent := Start("launch", nil)
+	child := StartClient("docker.container_create", parent).SetAttribute("image", "maven:3").SetError(errors.New("no such image"))
+	child.End()
+	child.End()
+	Flush(time.Second)
+
+	req := <-requests
+	AssertThat(t, len(req.ResourceSpans), EqualTo{1})
+	AssertThat(t, *req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue, EqualTo{"rt-test"})
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	AssertThat(t, len(spans), EqualTo{1})
+	AssertThat(t, spans[0].Name, EqualTo{"docker.container_create"})
+	AssertThat(t, spans[0].TraceId, EqualTo{parent.TraceId()})
+	AssertThat(t, spans[0].ParentSpanId, EqualTo{parent.SpanId()})
+	AssertThat(t, spans[0].Kind, EqualTo{clientKind})
+	AssertThat(t, spans[0].Status, EqualTo{status{Code: 2, Message: "no such image"}})
+	AssertThat(t, *spans[0].Attributes[0].Value.StringValue, EqualTo{"maven:3"})
+}
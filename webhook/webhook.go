@@ -0,0 +1,264 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/event"
+	"github.com/aerokube/rt/logging"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers sent with every payload
+const (
+	EventHeader     = "X-RT-Event"
+	DeliveryHeader  = "X-RT-Delivery"
+	SignatureHeader = "X-RT-Signature" // sha256=<hex HMAC of body>
+)
+
+// JSON body posted to webhook URL
+type Payload struct {
+	Delivery   string    `json:"delivery"` // Unique ID, the same for all attempts
+	Type       string    `json:"type"`
+	LaunchId   string    `json:"launchId,omitempty"`
+	TestCaseId string    `json:"testCaseId,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+func newPayload(evt event.Event) Payload {
+	p := Payload{Delivery: deliveryId(), Type: evt.Type, Timestamp: time.Now()}
+	switch evt.Type {
+	case event.LaunchStarted, event.LaunchFinished:
+		p.LaunchId = evt.Id
+	case event.ConfigReloaded:
+	default:
+		p.LaunchId, p.TestCaseId = evt.LaunchId, evt.Id
+	}
+	return p
+}
+
+func deliveryId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Sign returns signature header value for payload body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Validate checks webhook URLs and event types returning ValidationError listing all found problems
+func Validate(hooks []Webhook) error {
+	var problems ValidationError
+	for i, hook := range hooks {
+		u, err := url.Parse(hook.Url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("webhooks[%d].url: invalid: %q", i, hook.Url))
+		}
+		for j, eventType := range hook.Events {
+			if !event.IsKnown(eventType) {
+				problems = append(problems, fmt.Sprintf("webhooks[%d].events[%d]: unknown event type: %q", i, j, eventType))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// Allowed returns true when webhook URL has the same scheme and host as one of
+// prefixes and its path starts with prefix path
+func Allowed(rawUrl string, prefixes []string) bool {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.User != nil {
+		return false
+	}
+	for _, prefix := range prefixes {
+		p, err := url.Parse(prefix)
+		if err != nil {
+			continue
+		}
+		if !strings.EqualFold(u.Scheme, p.Scheme) || !strings.EqualFold(u.Host, p.Host) {
+			continue
+		}
+		if p.Path == "" || strings.HasSuffix(p.Path, "/") && strings.HasPrefix(u.Path, p.Path) || u.Path == p.Path || strings.HasPrefix(u.Path, p.Path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func subscribed(hook Webhook, eventType string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, t := range hook.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatcher posts events to global and per-launch webhooks
+type Dispatcher struct {
+	Global         func() []Webhook // Webhooks receiving events of all launches
+	DeadLetterPath string           // File to append failed deliveries to
+	Attempts       int
+	Backoff        time.Duration // Delay before first retry, doubled after every attempt
+
+	client         *http.Client
+	lock           sync.RWMutex
+	launches       map[string][]Webhook
+	deadLetterLock sync.Mutex
+	pending        sync.WaitGroup
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		Global:   func() []Webhook { return nil },
+		Attempts: 5,
+		Backoff:  time.Second,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// Redirects could lead payloads to URLs not allowed for launch webhooks
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		launches: make(map[string][]Webhook),
+	}
+}
+
+// Register adds webhooks receiving events of one launch
+func (d *Dispatcher) Register(launchId string, hooks []Webhook) {
+	if len(hooks) == 0 {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.launches[launchId] = hooks
+}
+
+func (d *Dispatcher) Unregister(launchId string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.launches, launchId)
+}
+
+// Dispatch chooses webhooks subscribed to event and delivers it in background
+func (d *Dispatcher) Dispatch(evt event.Event) {
+	payload := newPayload(evt)
+	hooks := d.Global()
+	if payload.LaunchId != "" {
+		d.lock.RLock()
+		hooks = append(hooks[:len(hooks):len(hooks)], d.launches[payload.LaunchId]...)
+		d.lock.RUnlock()
+	}
+	for _, hook := range hooks {
+		if subscribed(hook, evt.Type) {
+			d.pending.Add(1)
+			go func(hook Webhook) {
+				defer d.pending.Done()
+				d.deliver(hook, payload)
+			}(hook)
+		}
+	}
+}
+
+// Wait returns true when all dispatched payloads were delivered or dead lettered before timeout
+func (d *Dispatcher) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (d *Dispatcher) deliver(hook Webhook, payload Payload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logging.Err(err).Error("FAILED_TO_SERIALIZE_WEBHOOK")
+		return
+	}
+	entry := logging.Launch(payload.LaunchId).TestCase(payload.TestCaseId).With("url", hook.Url).With("type", payload.Type).With("delivery", payload.Delivery)
+	backoff := d.Backoff
+	for attempt := 1; ; attempt++ {
+		err = d.send(hook, payload, body)
+		if err == nil {
+			entry.With("attempt", attempt).Debug("WEBHOOK_DELIVERED")
+			return
+		}
+		if attempt >= d.Attempts {
+			entry.With("attempts", attempt).Err(err).Error("WEBHOOK_FAILED")
+			d.deadLetter(hook, payload, attempt, err)
+			return
+		}
+		entry.With("attempt", attempt).Err(err).Warn("WEBHOOK_RETRY")
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (d *Dispatcher) send(hook Webhook, payload Payload, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, payload.Type)
+	req.Header.Set(DeliveryHeader, payload.Delivery)
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+	}
+	rsp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", rsp.Status)
+	}
+	return nil
+}
+
+// Appends failed delivery as JSON line, secret is never written
+func (d *Dispatcher) deadLetter(hook Webhook, payload Payload, attempts int, cause error) {
+	if d.DeadLetterPath == "" {
+		return
+	}
+	line, _ := json.Marshal(struct {
+		Url      string    `json:"url"`
+		Payload  Payload   `json:"payload"`
+		Attempts int       `json:"attempts"`
+		Error    string    `json:"error"`
+		Failed   time.Time `json:"failed"`
+	}{hook.Url, payload, attempts, cause.Error(), time.Now()})
+	d.deadLetterLock.Lock()
+	defer d.deadLetterLock.Unlock()
+	f, err := os.OpenFile(d.DeadLetterPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		logging.With("path", d.DeadLetterPath).Err(err).Error("FAILED_TO_WRITE_DEAD_LETTER")
+		return
+	}
+	defer f.Close()
+	f.Write(append(line, '\n'))
+}
@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/aandryashin/matchers"
+	. "github.com/aerokube/rt/common"
+	"github.com/aerokube/rt/event"
+)
+
+type received struct {
+	payload   Payload
+	signature string
+	event     string
+}
+
+func testServer(failures int) (*httptest.Server, chan received) {
+	var lock sync.Mutex
+	ch := make(chan received, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var p Payload
+		json.Unmarshal(body, &p)
+		ch <- received{p, r.Header.Get(SignatureHeader), r.Header.Get(EventHeader)}
+		if r.Header.Get(SignatureHeader) != "" && r.Header.Get(SignatureHeader) != Sign("secret", body) {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	return srv, ch
+}
+
+func testDispatcher() *Dispatcher {
+	d := NewDispatcher()
+	d.Backoff = time.Millisecond
+	return d
+}
+
+func TestSign(t *testing.T) {
+	AssertThat(t, Sign("It's a Secret to Everybody", []byte("Hello, World!")), EqualTo{"sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"})
+}
+
+func TestValidate(t *testing.T) {
+	AssertThat(t, Validate([]Webhook{{Url: "https://example.com/hook", Events: []string{event.LaunchFinished}}}), Is{nil})
+	err := Validate([]Webhook{{Url: "example.com"}, {Url: "http://example.com", Events: []string{event.LaunchFinished, "launch_exploded"}}})
+	AssertThat(t, err, EqualTo{ValidationError{
+		`webhooks[0].url: invalid: "example.com"`,
+		`webhooks[1].events[1]: unknown event type: "launch_exploded"`,
+	}})
+}
+
+func TestAllowed(t *testing.T) {
+	prefixes := []string{"https://bot.example.com/rt", "http://ci.example.com"}
+	AssertThat(t, Allowed("https://bot.example.com/rt", prefixes), Is{true})
+	AssertThat(t, Allowed("https://BOT.example.com/rt/hook", prefixes), Is{true})
+	AssertThat(t, Allowed("http://ci.example.com/any/path", prefixes), Is{true})
+	AssertThat(t, Allowed("https://bot.example.com/rtx", prefixes), Is{false})
+	AssertThat(t, Allowed("http://bot.example.com/rt", prefixes), Is{false})
+	AssertThat(t, Allowed("https://bot.example.com.evil.com/rt", prefixes), Is{false})
+	AssertThat(t, Allowed("https://bot.example.com:8443/rt", prefixes), Is{false})
+	AssertThat(t, Allowed("https://user@bot.example.com/rt", prefixes), Is{false})
+	AssertThat(t, Allowed("https://bot.example.com/rt", nil), Is{false})
+}
+
+func TestDispatchLaunchWebhook(t *testing.T) {
+	srv, ch := testServer(0)
+	defer srv.Close()
+	d := testDispatcher()
+	d.Register("launch-1", []Webhook{{Url: srv.URL, Events: []string{event.TestCaseFailed}, Secret: "secret"}})
+
+	d.Dispatch(event.Event{Type: event.TestCasePassed, Id: "tc-1", LaunchId: "launch-1"})
+	d.Dispatch(event.Event{Type: event.TestCaseFailed, Id: "tc-2", LaunchId: "launch-2"})
+	d.Dispatch(event.Event{Type: event.TestCaseFailed, Id: "tc-3", LaunchId: "launch-1"})
+
+	r := <-ch
+	AssertThat(t, r.event, EqualTo{event.TestCaseFailed})
+	AssertThat(t, r.payload.LaunchId, EqualTo{"launch-1"})
+	AssertThat(t, r.payload.TestCaseId, EqualTo{"tc-3"})
+	AssertThat(t, strings.HasPrefix(r.signature, "sha256="), Is{true})
+	select {
+	case r := <-ch:
+		t.Fatalf("unexpected delivery: %v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	d.Unregister("launch-1")
+	d.Dispatch(event.Event{Type: event.TestCaseFailed, Id: "tc-4", LaunchId: "launch-1"})
+	select {
+	case r := <-ch:
+		t.Fatalf("unexpected delivery: %v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDispatchRetries(t *testing.T) {
+	srv, ch := testServer(2)
+	defer srv.Close()
+	d := testDispatcher()
+	d.Global = func() []Webhook { return []Webhook{{Url: srv.URL}} }
+
+	d.Dispatch(event.Event{Type: event.LaunchFinished, Id: "launch-1"})
+
+	r := <-ch
+	AssertThat(t, r.payload.Type, EqualTo{event.LaunchFinished})
+	AssertThat(t, r.payload.LaunchId, EqualTo{"launch-1"})
+	AssertThat(t, r.signature, EqualTo{""})
+}
+
+func TestDeadLetter(t *testing.T) {
+	srv, _ := testServer(100)
+	defer srv.Close()
+	dir, _ := ioutil.TempDir("", "rt-webhook")
+	defer os.RemoveAll(dir)
+	d := testDispatcher()
+	d.Attempts = 2
+	d.DeadLetterPath = path.Join(dir, "dead-letter.log")
+
+	d.deliver(Webhook{Url: srv.URL, Secret: "secret"}, Payload{Delivery: "d-1", Type: event.LaunchStarted, LaunchId: "launch-1"})
+
+	data, err := ioutil.ReadFile(d.DeadLetterPath)
+	AssertThat(t, err, Is{nil})
+	var line struct {
+		Url      string
+		Payload  Payload
+		Attempts int
+		Error    string
+	}
+	AssertThat(t, json.Unmarshal(data, &line), Is{nil})
+	AssertThat(t, line.Url, EqualTo{srv.URL})
+	AssertThat(t, line.Payload.Delivery, EqualTo{"d-1"})
+	AssertThat(t, line.Attempts, EqualTo{2})
+	AssertThat(t, strings.Contains(string(data), "secret"), Is{false})
+}
+
+func TestWait(t *testing.T) {
+	srv, ch := testServer(1)
+	defer srv.Close()
+	d := testDispatcher()
+	d.Global = func() []Webhook { return []Webhook{{Url: srv.URL}} }
+	AssertThat(t, d.Wait(time.Second), Is{true})
+
+	d.Dispatch(event.Event{Type: event.LaunchFinished, Id: "launch-1"})
+
+	AssertThat(t, d.Wait(5*time.Second), Is{true})
+	AssertThat(t, len(ch), EqualTo{1})
+}